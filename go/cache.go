@@ -0,0 +1,166 @@
+package istanbul
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"unsafe"
+)
+
+// DefaultCacheSize is the memory budget, in bytes, of the source map cache
+// created by NewCoverageTransformer when no cache is given
+const DefaultCacheSize = 256 << 20
+
+// cacheKey identifies a source map by the SHA-256 hash of the fields read
+// when parsing it
+type cacheKey [sha256.Size]byte
+
+// sourceMapKey returns the cache key of a flat source map. Only the fields
+// used by newSourceMapConsumer are hashed, so that maps sharing file and
+// mappings but differing in sources do not collide while sourcesContent,
+// which can be large, is never hashed.
+func sourceMapKey(sm *SourceMap) cacheKey {
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	writeInt := func(n int) {
+		h.Write(buf[:binary.PutVarint(buf[:], int64(n))])
+	}
+	// Strings are prefixed with their length so that lists cannot collide
+	writeStrings := func(values ...string) {
+		for _, value := range values {
+			writeInt(len(value))
+			h.Write([]byte(value))
+		}
+	}
+
+	writeInt(sm.Version)
+	writeStrings(sm.SourceRoot, sm.Mappings)
+	writeInt(len(sm.Sources))
+	writeStrings(sm.Sources...)
+	writeInt(len(sm.Names))
+	writeStrings(sm.Names...)
+
+	var key cacheKey
+	h.Sum(key[:0])
+	return key
+}
+
+// CacheStats reports the activity of a ConsumerCache
+type CacheStats struct {
+	Hits      uint64 // lookups that found a parsed source map
+	Misses    uint64 // lookups that had to parse the source map
+	Evictions uint64 // parsed source maps dropped to stay within the budget
+	Entries   int    // parsed source maps currently cached
+	Size      int64  // estimated memory used by the cached maps, in bytes
+}
+
+// ConsumerCache is a concurrency-safe LRU cache of parsed source maps. It is
+// bounded by the estimated memory of the parsed maps and can be shared by
+// several transformers with WithCache.
+type ConsumerCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+	stats   CacheStats
+}
+
+// cacheEntry is a parsed source map held by a ConsumerCache
+type cacheEntry struct {
+	key      cacheKey
+	consumer *sourceMapConsumer
+	size     int64
+}
+
+// NewConsumerCache creates a cache holding parsed source maps up to an
+// estimated maxSize bytes. A maxSize <= 0 means the cache is unbounded.
+func NewConsumerCache(maxSize int64) *ConsumerCache {
+	return &ConsumerCache{
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// Stats returns a snapshot of the cache statistics
+func (c *ConsumerCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Size = c.size
+	return stats
+}
+
+// Purge removes all cached source maps. Statistics are kept.
+func (c *ConsumerCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[cacheKey]*list.Element)
+	c.size = 0
+}
+
+// get returns the consumer cached under key, marking it as recently used
+func (c *ConsumerCache) get(key cacheKey) (*sourceMapConsumer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).consumer, true
+}
+
+// put caches consumer under key, evicting the least recently used maps to
+// stay within the budget. Maps larger than the whole budget are not cached.
+func (c *ConsumerCache) put(key cacheKey, consumer *sourceMapConsumer) {
+	size := consumer.size()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		// Parsed concurrently by another transformer
+		c.lru.MoveToFront(elem)
+		return
+	}
+	if c.maxSize > 0 && size > c.maxSize {
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, consumer: consumer, size: size})
+	c.size += size
+
+	for c.maxSize > 0 && c.size > c.maxSize {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.lru.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		c.stats.Evictions++
+	}
+}
+
+// size estimates the memory used by a parsed source map
+func (c *sourceMapConsumer) size() int64 {
+	const stringHeader = int64(unsafe.Sizeof(""))
+
+	n := int64(unsafe.Sizeof(*c))
+	n += int64(len(c.generated)+len(c.original)) * int64(unsafe.Sizeof(mapping{}))
+	for _, s := range c.sources {
+		n += stringHeader + int64(len(s))
+	}
+	for _, s := range c.names {
+		n += stringHeader + int64(len(s))
+	}
+	return n
+}
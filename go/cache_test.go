@@ -0,0 +1,137 @@
+package istanbul
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSourceMap(source string) *SourceMap {
+	return &SourceMap{
+		Version:  3,
+		Sources:  []string{source},
+		Names:    []string{},
+		Mappings: "AAAA;AACA",
+	}
+}
+
+func TestConsumerCacheStats(t *testing.T) {
+	cache := NewConsumerCache(0)
+	smt := NewSourceMapTransformerWithCache(cache)
+
+	sm := testSourceMap("src/a.ts")
+	_, err := smt.GetOriginalPosition(sm, Position{Line: 1, Column: 0})
+	require.NoError(t, err)
+
+	// A different transformer sees an equal map only through the cache
+	other := NewSourceMapTransformerWithCache(cache)
+	_, err = other.GetOriginalPosition(testSourceMap("src/a.ts"), Position{Line: 2, Column: 0})
+	require.NoError(t, err)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(0), stats.Evictions)
+	assert.Equal(t, 1, stats.Entries)
+	assert.Positive(t, stats.Size)
+
+	cache.Purge()
+	stats = cache.Stats()
+	assert.Equal(t, 0, stats.Entries)
+	assert.Equal(t, int64(0), stats.Size)
+	assert.Equal(t, uint64(1), stats.Hits)
+}
+
+func TestConsumerCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	consumer, err := newSourceMapConsumer(testSourceMap("src/a.ts"))
+	require.NoError(t, err)
+	size := consumer.size()
+
+	cache := NewConsumerCache(2 * size)
+	keys := make([]cacheKey, 3)
+	for i := range keys {
+		keys[i][0] = byte(i)
+	}
+
+	cache.put(keys[0], consumer)
+	cache.put(keys[1], consumer)
+	_, ok := cache.get(keys[0]) // keys[1] is now least recently used
+	require.True(t, ok)
+	cache.put(keys[2], consumer)
+
+	_, ok = cache.get(keys[1])
+	assert.False(t, ok)
+	_, ok = cache.get(keys[0])
+	assert.True(t, ok)
+	_, ok = cache.get(keys[2])
+	assert.True(t, ok)
+
+	stats := cache.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 2*size, stats.Size)
+}
+
+func TestConsumerCacheSkipsOversizedMaps(t *testing.T) {
+	consumer, err := newSourceMapConsumer(testSourceMap("src/a.ts"))
+	require.NoError(t, err)
+
+	cache := NewConsumerCache(1)
+	cache.put(cacheKey{}, consumer)
+	assert.Equal(t, 0, cache.Stats().Entries)
+
+	// Lookups still work without caching
+	smt := NewSourceMapTransformerWithCache(cache)
+	result, err := smt.GetOriginalPosition(testSourceMap("src/a.ts"), Position{Line: 2, Column: 0})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Location.Start.Line)
+}
+
+func TestSourceMapKey(t *testing.T) {
+	key := sourceMapKey(testSourceMap("src/a.ts"))
+
+	// Fields not read by the parser do not change the key
+	content := "export {}"
+	sm := testSourceMap("src/a.ts")
+	sm.File = "bundle.js"
+	sm.SourcesContent = []*string{&content}
+	assert.Equal(t, key, sourceMapKey(sm))
+
+	for name, modify := range map[string]func(sm *SourceMap){
+		"sources":     func(sm *SourceMap) { sm.Sources = []string{"src/b.ts"} },
+		"split":       func(sm *SourceMap) { sm.Sources = []string{"src/a", ".ts"} },
+		"source root": func(sm *SourceMap) { sm.SourceRoot = "/app/" },
+		"names":       func(sm *SourceMap) { sm.Names = []string{"a"} },
+		"mappings":    func(sm *SourceMap) { sm.Mappings = "AAAA" },
+	} {
+		sm := testSourceMap("src/a.ts")
+		modify(sm)
+		assert.NotEqual(t, key, sourceMapKey(sm), name)
+	}
+}
+
+func TestWithCacheSharesParsedMaps(t *testing.T) {
+	first := New()
+	second := New(WithCache(first.Cache()))
+	assert.Same(t, first.Cache(), second.Cache())
+
+	coverage := make(CoverageMap)
+	for i := 0; i < 3; i++ {
+		fc := largeBundleCoverage(10)["dist/bundle.js"]
+		fc.Path = fmt.Sprintf("dist/bundle%d.js", i)
+		coverage[fc.Path] = fc
+	}
+
+	_, err := first.transformer.Transform(coverage)
+	require.NoError(t, err)
+	_, err = second.transformer.Transform(coverage)
+	require.NoError(t, err)
+
+	// The bundles share one source map, parsed once for both instances
+	stats := first.Cache().Stats()
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(5), stats.Hits)
+	assert.Equal(t, 1, stats.Entries)
+}
@@ -0,0 +1,199 @@
+package istanbul
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CloverOptions configures WriteClover
+type CloverOptions struct {
+	// ProjectName names the project element. Defaults to "All files".
+	ProjectName string
+	// ProjectRoot decides the packages: files are grouped by their directory
+	// relative to it. File paths are written unchanged.
+	ProjectRoot string
+	// Timestamp of the report. Defaults to the current time.
+	Timestamp time.Time
+}
+
+// WriteClover writes the coverage map as Clover XML, with the same structure
+// as the clover reporter of istanbul: a project holding packages by
+// directory, files with their statement, method and conditional counts, and
+// a line entry for each line with statements. Files at the root are written
+// directly under the project.
+func (cm CoverageMap) WriteClover(w io.Writer, opts CloverOptions) error {
+	name := opts.ProjectName
+	if name == "" {
+		name = "All files"
+	}
+	timestamp := opts.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	millis := strconv.FormatInt(timestamp.UnixMilli(), 10)
+
+	// Packages with the summary of their files
+	type packageSummary struct {
+		pkg     cloverPackage
+		summary Summary
+	}
+	project := cloverProject{Timestamp: millis, Name: name}
+	total := emptySummary()
+	packages := make(map[string]*packageSummary)
+	for _, key := range sortedPaths(cm) {
+		fc := cm[key]
+		if fc == nil {
+			continue
+		}
+		filePath := fc.pathOr(key)
+		relative := filepath.ToSlash(relativeTo(opts.ProjectRoot, filePath))
+
+		summary := fc.Summary()
+		file := newCloverFile(path.Base(relative), filePath, fc, summary)
+		total.Merge(summary)
+		project.Metrics.Files++
+		if path.Dir(relative) == "." || path.Dir(relative) == "/" {
+			project.Files = append(project.Files, file)
+			continue
+		}
+
+		pkgName := javaPackageName(relative)
+		p, exists := packages[pkgName]
+		if !exists {
+			p = &packageSummary{pkg: cloverPackage{Name: pkgName}, summary: emptySummary()}
+			packages[pkgName] = p
+		}
+		p.pkg.Files = append(p.pkg.Files, file)
+		p.summary.Merge(summary)
+	}
+
+	pkgNames := make([]string, 0, len(packages))
+	for pkgName := range packages {
+		pkgNames = append(pkgNames, pkgName)
+	}
+	sort.Strings(pkgNames)
+	for _, pkgName := range pkgNames {
+		p := packages[pkgName]
+		p.pkg.Metrics = newCloverMetrics(p.summary)
+		project.Packages = append(project.Packages, p.pkg)
+	}
+
+	project.Metrics.cloverMetrics = newCloverMetrics(total)
+	project.Metrics.Packages = len(packages)
+	project.Metrics.Classes = project.Metrics.Files
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	enc := xml.NewEncoder(bw)
+	enc.Indent("", "  ")
+	if err := enc.Encode(cloverCoverage{Generated: millis, Clover: "3.2.0", Project: project}); err != nil {
+		return err
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+// newCloverMetrics returns the metrics of a summary as istanbul writes
+// them, with lines counted as statements
+func newCloverMetrics(s Summary) cloverMetrics {
+	return cloverMetrics{
+		Statements:          s.Lines.Total,
+		CoveredStatements:   s.Lines.Covered,
+		Conditionals:        s.Branches.Total,
+		CoveredConditionals: s.Branches.Covered,
+		Methods:             s.Functions.Total,
+		CoveredMethods:      s.Functions.Covered,
+		Elements:            s.Lines.Total + s.Branches.Total + s.Functions.Total,
+		CoveredElements:     s.Lines.Covered + s.Branches.Covered + s.Functions.Covered,
+		LOC:                 s.Lines.Total,
+		NCLOC:               s.Lines.Total,
+	}
+}
+
+// newCloverFile builds the file element of one file with the given summary
+func newCloverFile(name, filePath string, fc *FileCoverage, summary Summary) cloverFile {
+	file := cloverFile{Name: name, Path: filePath, Metrics: newCloverMetrics(summary)}
+
+	branches := fc.BranchCoverageByLine()
+	hits := fc.LineCoverage()
+	for _, number := range sortedLines(hits) {
+		line := cloverLine{Num: number, Count: hits[number], Type: "stmt"}
+		if branch, exists := branches[number]; exists {
+			line.Type = "cond"
+			line.TrueCount = strconv.Itoa(branch.Covered)
+			line.FalseCount = strconv.Itoa(branch.Total - branch.Covered)
+		}
+		file.Lines = append(file.Lines, line)
+	}
+	return file
+}
+
+// cloverCoverage is the root element of a Clover report
+type cloverCoverage struct {
+	XMLName   xml.Name      `xml:"coverage"`
+	Generated string        `xml:"generated,attr"`
+	Clover    string        `xml:"clover,attr"`
+	Project   cloverProject `xml:"project"`
+}
+
+// cloverProject holds the packages and the files at the root
+type cloverProject struct {
+	Timestamp string               `xml:"timestamp,attr"`
+	Name      string               `xml:"name,attr"`
+	Metrics   cloverProjectMetrics `xml:"metrics"`
+	Packages  []cloverPackage      `xml:"package"`
+	Files     []cloverFile         `xml:"file"`
+}
+
+// cloverMetrics holds the counts of a package or file
+type cloverMetrics struct {
+	Statements          int `xml:"statements,attr"`
+	CoveredStatements   int `xml:"coveredstatements,attr"`
+	Conditionals        int `xml:"conditionals,attr"`
+	CoveredConditionals int `xml:"coveredconditionals,attr"`
+	Methods             int `xml:"methods,attr"`
+	CoveredMethods      int `xml:"coveredmethods,attr"`
+	Elements            int `xml:"elements,attr"`
+	CoveredElements     int `xml:"coveredelements,attr"`
+	Complexity          int `xml:"complexity,attr"`
+	LOC                 int `xml:"loc,attr"`
+	NCLOC               int `xml:"ncloc,attr"`
+}
+
+// cloverProjectMetrics holds the counts of the project
+type cloverProjectMetrics struct {
+	cloverMetrics
+	Packages int `xml:"packages,attr"`
+	Files    int `xml:"files,attr"`
+	Classes  int `xml:"classes,attr"`
+}
+
+// cloverPackage holds the files of one directory
+type cloverPackage struct {
+	Name    string        `xml:"name,attr"`
+	Metrics cloverMetrics `xml:"metrics"`
+	Files   []cloverFile  `xml:"file"`
+}
+
+// cloverFile holds the coverage of one file
+type cloverFile struct {
+	Name    string        `xml:"name,attr"`
+	Path    string        `xml:"path,attr"`
+	Metrics cloverMetrics `xml:"metrics"`
+	Lines   []cloverLine  `xml:"line"`
+}
+
+// cloverLine holds the hits of one line
+type cloverLine struct {
+	Num        int    `xml:"num,attr"`
+	Count      int    `xml:"count,attr"`
+	Type       string `xml:"type,attr"`
+	TrueCount  string `xml:"truecount,attr,omitempty"`
+	FalseCount string `xml:"falsecount,attr,omitempty"`
+}
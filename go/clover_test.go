@@ -0,0 +1,57 @@
+package istanbul
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteClover(t *testing.T) {
+	coverage := reporterCoverage()
+	coverage["/project/index.ts"] = &FileCoverage{
+		Path:         "/project/index.ts",
+		StatementMap: map[string]Location{"0": {Start: Position{Line: 1}, End: Position{Line: 1, Column: 9}}},
+		S:            map[string]int{"0": 1},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, coverage.WriteClover(&buf, CloverOptions{
+		ProjectRoot: "/project",
+		Timestamp:   time.UnixMilli(1700000000000),
+	}))
+
+	// Lines are counted as statements, as istanbul does
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<coverage generated="1700000000000" clover="3.2.0">
+  <project timestamp="1700000000000" name="All files">
+    <metrics statements="6" coveredstatements="5" conditionals="2" coveredconditionals="1" methods="2" `+
+		`coveredmethods="1" elements="10" coveredelements="7" complexity="0" loc="6" ncloc="6" packages="1" files="3" classes="3"></metrics>
+    <package name="src">
+      <metrics statements="5" coveredstatements="4" conditionals="2" coveredconditionals="1" methods="2" `+
+		`coveredmethods="1" elements="9" coveredelements="6" complexity="0" loc="5" ncloc="5"></metrics>
+      <file name="a.ts" path="src/a.ts">
+        <metrics statements="5" coveredstatements="4" conditionals="2" coveredconditionals="1" methods="2" `+
+		`coveredmethods="1" elements="9" coveredelements="6" complexity="0" loc="5" ncloc="5"></metrics>
+        <line num="1" count="1" type="stmt"></line>
+        <line num="2" count="3" type="stmt"></line>
+        <line num="5" count="1" type="stmt"></line>
+        <line num="6" count="0" type="cond" truecount="1" falsecount="1"></line>
+        <line num="8" count="2" type="stmt"></line>
+      </file>
+      <file name="b.ts" path="src/b.ts">
+        <metrics statements="0" coveredstatements="0" conditionals="0" coveredconditionals="0" methods="0" `+
+		`coveredmethods="0" elements="0" coveredelements="0" complexity="0" loc="0" ncloc="0"></metrics>
+      </file>
+    </package>
+    <file name="index.ts" path="/project/index.ts">
+      <metrics statements="1" coveredstatements="1" conditionals="0" coveredconditionals="0" methods="0" `+
+		`coveredmethods="0" elements="1" coveredelements="1" complexity="0" loc="1" ncloc="1"></metrics>
+      <line num="1" count="1" type="stmt"></line>
+    </file>
+  </project>
+</coverage>
+`, buf.String())
+}
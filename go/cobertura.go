@@ -0,0 +1,201 @@
+package istanbul
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CoberturaOptions configures WriteCobertura
+type CoberturaOptions struct {
+	// ProjectRoot is written as the report source; absolute file paths
+	// inside it are written relative to it. Defaults to ".".
+	ProjectRoot string
+	// Timestamp of the report. Defaults to the current time.
+	Timestamp time.Time
+}
+
+// WriteCobertura writes the coverage map as Cobertura XML, with the same
+// structure as the cobertura reporter of istanbul: files are grouped into
+// packages by directory, each file is a class with its functions as methods,
+// and lines with branches carry their condition coverage.
+func (cm CoverageMap) WriteCobertura(w io.Writer, opts CoberturaOptions) error {
+	root := opts.ProjectRoot
+	if root == "" {
+		root = "."
+	}
+	timestamp := opts.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	report := coberturaCoverage{
+		Timestamp: timestamp.UnixMilli(),
+		Version:   "0.1",
+		Sources:   []string{root},
+	}
+
+	// Packages with the summary of their files
+	type packageSummary struct {
+		pkg     coberturaPackage
+		summary Summary
+	}
+	total := emptySummary()
+	packages := make(map[string]*packageSummary)
+	for _, key := range sortedPaths(cm) {
+		fc := cm[key]
+		if fc == nil {
+			continue
+		}
+		filename := filepath.ToSlash(relativeTo(opts.ProjectRoot, fc.pathOr(key)))
+		summary := fc.Summary()
+
+		name := javaPackageName(filename)
+		p, exists := packages[name]
+		if !exists {
+			p = &packageSummary{pkg: coberturaPackage{Name: name}, summary: emptySummary()}
+			packages[name] = p
+		}
+		p.pkg.Classes = append(p.pkg.Classes, newCoberturaClass(filename, fc, summary))
+		p.summary.Merge(summary)
+		total.Merge(summary)
+	}
+
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := packages[name]
+		p.pkg.LineRate = coberturaRate(p.summary.Lines)
+		p.pkg.BranchRate = coberturaRate(p.summary.Branches)
+		report.Packages = append(report.Packages, p.pkg)
+	}
+
+	report.LinesValid, report.LinesCovered = total.Lines.Total, total.Lines.Covered
+	report.LineRate = coberturaRate(total.Lines)
+	report.BranchesValid, report.BranchesCovered = total.Branches.Total, total.Branches.Covered
+	report.BranchRate = coberturaRate(total.Branches)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">` + "\n")
+	enc := xml.NewEncoder(bw)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+// coberturaRate returns the covered fraction as istanbul reports it, from
+// the percentage truncated to two decimals
+func coberturaRate(t Totals) string {
+	return strconv.FormatFloat(t.Pct/100, 'f', -1, 64)
+}
+
+// javaPackageName returns the package of a file: its directory with
+// dots for slashes, or "main" for files at the root
+func javaPackageName(filename string) string {
+	dir := strings.Trim(strings.ReplaceAll(path.Dir(filename), "/", "."), ".")
+	if dir == "" {
+		return "main"
+	}
+	return dir
+}
+
+// newCoberturaClass builds the class of one file with the given summary
+func newCoberturaClass(filename string, fc *FileCoverage, summary Summary) coberturaClass {
+	class := coberturaClass{
+		Name:       path.Base(filename),
+		Filename:   filename,
+		LineRate:   coberturaRate(summary.Lines),
+		BranchRate: coberturaRate(summary.Branches),
+	}
+
+	for _, id := range sortedIDs(fc.FnMap) {
+		fn := fc.FnMap[id]
+		line := fn.Decl.Start.Line
+		if line == 0 {
+			line = fn.Loc.Start.Line // Some instrumenters only set loc
+		}
+		hits := fc.F[id]
+		class.Methods = append(class.Methods, coberturaMethod{
+			Name:      fn.Name,
+			Hits:      hits,
+			Signature: "()V",
+			Lines:     []coberturaLine{{Number: line, Hits: hits}},
+		})
+	}
+
+	branches := fc.BranchCoverageByLine()
+	hits := fc.LineCoverage()
+	for _, number := range sortedLines(hits) {
+		line := coberturaLine{Number: number, Hits: hits[number], Branch: "false"}
+		if branch, exists := branches[number]; exists {
+			line.Branch = "true"
+			coverage := strconv.FormatFloat(branch.Coverage, 'f', -1, 64)
+			line.ConditionCoverage = coverage + "% (" + strconv.Itoa(branch.Covered) + "/" + strconv.Itoa(branch.Total) + ")"
+		}
+		class.Lines = append(class.Lines, line)
+	}
+	return class
+}
+
+// coberturaCoverage is the root element of a Cobertura report
+type coberturaCoverage struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+// coberturaPackage holds the files of one directory
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+// coberturaClass holds the coverage of one file
+type coberturaClass struct {
+	Name       string            `xml:"name,attr"`
+	Filename   string            `xml:"filename,attr"`
+	LineRate   string            `xml:"line-rate,attr"`
+	BranchRate string            `xml:"branch-rate,attr"`
+	Methods    []coberturaMethod `xml:"methods>method"`
+	Lines      []coberturaLine   `xml:"lines>line"`
+}
+
+// coberturaMethod holds the hits of one function
+type coberturaMethod struct {
+	Name      string          `xml:"name,attr"`
+	Hits      int             `xml:"hits,attr"`
+	Signature string          `xml:"signature,attr"`
+	Lines     []coberturaLine `xml:"lines>line"`
+}
+
+// coberturaLine holds the hits of one line
+type coberturaLine struct {
+	Number            int    `xml:"number,attr"`
+	Hits              int    `xml:"hits,attr"`
+	Branch            string `xml:"branch,attr,omitempty"`
+	ConditionCoverage string `xml:"condition-coverage,attr,omitempty"`
+}
@@ -0,0 +1,82 @@
+package istanbul
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCobertura(t *testing.T) {
+	coverage := reporterCoverage()
+	coverage["/project/index.ts"] = &FileCoverage{
+		Path:         "/project/index.ts",
+		StatementMap: map[string]Location{"0": {Start: Position{Line: 1}, End: Position{Line: 1, Column: 9}}},
+		S:            map[string]int{"0": 1},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, coverage.WriteCobertura(&buf, CoberturaOptions{
+		ProjectRoot: "/project",
+		Timestamp:   time.UnixMilli(1700000000000),
+	}))
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE coverage SYSTEM "http://cobertura.sourceforge.net/xml/coverage-04.dtd">
+<coverage lines-valid="6" lines-covered="5" line-rate="0.8332999999999999" branches-valid="2" `+
+		`branches-covered="1" branch-rate="0.5" timestamp="1700000000000" complexity="0" version="0.1">
+  <sources>
+    <source>/project</source>
+  </sources>
+  <packages>
+    <package name="main" line-rate="1" branch-rate="1">
+      <classes>
+        <class name="index.ts" filename="index.ts" line-rate="1" branch-rate="1">
+          <methods></methods>
+          <lines>
+            <line number="1" hits="1" branch="false"></line>
+          </lines>
+        </class>
+      </classes>
+    </package>
+    <package name="src" line-rate="0.8" branch-rate="0.5">
+      <classes>
+        <class name="a.ts" filename="src/a.ts" line-rate="0.8" branch-rate="0.5">
+          <methods>
+            <method name="alpha" hits="4" signature="()V">
+              <lines>
+                <line number="1" hits="4"></line>
+              </lines>
+            </method>
+            <method name="beta" hits="0" signature="()V">
+              <lines>
+                <line number="5" hits="0"></line>
+              </lines>
+            </method>
+          </methods>
+          <lines>
+            <line number="1" hits="1" branch="false"></line>
+            <line number="2" hits="3" branch="false"></line>
+            <line number="5" hits="1" branch="false"></line>
+            <line number="6" hits="0" branch="true" condition-coverage="50% (1/2)"></line>
+            <line number="8" hits="2" branch="false"></line>
+          </lines>
+        </class>
+        <class name="b.ts" filename="src/b.ts" line-rate="1" branch-rate="1">
+          <methods></methods>
+          <lines></lines>
+        </class>
+      </classes>
+    </package>
+  </packages>
+</coverage>
+`, buf.String())
+}
+
+func TestCoberturaPackageName(t *testing.T) {
+	assert.Equal(t, "main", javaPackageName("index.ts"))
+	assert.Equal(t, "src.utils", javaPackageName("src/utils/a.ts"))
+	assert.Equal(t, "lib", javaPackageName("/lib/a.ts"))
+}
@@ -0,0 +1,172 @@
+package istanbul
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors matched with errors.Is by the errors of this package
+var (
+	// ErrInvalidJSON is matched by errors for malformed JSON input
+	ErrInvalidJSON = errors.New("invalid JSON")
+	// ErrInvalidSourceMap is matched by errors for source maps that cannot
+	// be parsed
+	ErrInvalidSourceMap = errors.New("invalid source map")
+	// ErrInvalidCoverage is matched by errors for coverage data that does not
+	// follow the Istanbul format
+	ErrInvalidCoverage = errors.New("invalid coverage data")
+	// ErrNoMapping is matched by errors for positions the source map does not
+	// map to an original source
+	ErrNoMapping = errors.New("no mapping found")
+	// ErrUnmappable is matched by the *MappingError of strict mode
+	ErrUnmappable = errors.New("coverage item cannot be mapped")
+	// ErrAlreadyWritten is matched by errors of TransformStream for coverage
+	// that would have to be merged into an entry it has already written
+	ErrAlreadyWritten = errors.New("coverage already written")
+)
+
+// JSONError reports malformed JSON input
+type JSONError struct {
+	Offset int64 // input bytes read when the error occurred, if known
+	Err    error // the decoding error
+}
+
+// newJSONError wraps a JSON decoding error, extracting its offset
+func newJSONError(err error) *JSONError {
+	je := &JSONError{Err: err}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		je.Offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		je.Offset = typeErr.Offset
+	}
+	return je
+}
+
+// Error implements error
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("invalid JSON at offset %d: %v", e.Offset, e.Err)
+}
+
+// Unwrap returns the decoding error
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInvalidJSON
+func (e *JSONError) Is(target error) bool {
+	return target == ErrInvalidJSON
+}
+
+// SourceMapError reports a source map that cannot be parsed
+type SourceMapError struct {
+	File string // coverage map key of the generated file, if known
+	Err  error  // what is wrong with the source map
+}
+
+// Error implements error
+func (e *SourceMapError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("invalid source map: %v", e.Err)
+	}
+	return fmt.Sprintf("invalid source map for %s: %v", e.File, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *SourceMapError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInvalidSourceMap
+func (e *SourceMapError) Is(target error) bool {
+	return target == ErrInvalidSourceMap
+}
+
+// ValidationError reports coverage data that does not follow the Istanbul
+// format
+type ValidationError struct {
+	File    string // coverage map key
+	Field   string // field of the file entry, such as "statementMap", if any
+	ID      string // item ID within the field, if any
+	Msg     string // what is wrong
+	Pointer string // JSON pointer to the offending value, if known
+}
+
+// Error implements error
+func (e *ValidationError) Error() string {
+	if e.Pointer != "" {
+		return fmt.Sprintf("invalid coverage at %s: %s", e.Pointer, e.Msg)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid coverage for file %s", e.File)
+	if e.Field != "" {
+		fmt.Fprintf(&b, ", field %s", e.Field)
+	}
+	if e.ID != "" {
+		fmt.Fprintf(&b, ", id %s", e.ID)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// Is reports whether target is ErrInvalidCoverage
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidCoverage
+}
+
+// MappingError is returned in strict mode for the first statement, function
+// or branch of a generated file that cannot be transformed faithfully
+type MappingError struct {
+	File   string     // generated file path
+	Kind   string     // "statement", "function" or "branch"
+	ID     string     // item ID in the generated file
+	Reason DropReason // what is wrong with the item
+	Err    error      // underlying lookup error, if any
+}
+
+// Error implements error
+func (e *MappingError) Error() string {
+	msg := fmt.Sprintf("%s %s of %s: %s", e.Kind, e.ID, e.File, e.Reason)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying lookup error
+func (e *MappingError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrUnmappable
+func (e *MappingError) Is(target error) bool {
+	return target == ErrUnmappable
+}
+
+// CanceledError is returned when a transform is stopped by its context. It
+// unwraps to the context error, so errors.Is(err, context.Canceled) and
+// errors.Is(err, context.DeadlineExceeded) work as expected.
+type CanceledError struct {
+	Completed int   // generated files transformed before stopping
+	Total     int   // generated files with a source map, 0 if unknown
+	Err       error // the context error
+}
+
+// Error implements error
+func (e *CanceledError) Error() string {
+	if e.Total == 0 {
+		return fmt.Sprintf("transform canceled after %d files: %v", e.Completed, e.Err)
+	}
+	return fmt.Sprintf("transform canceled after %d of %d files: %v", e.Completed, e.Total, e.Err)
+}
+
+// Unwrap returns the context error
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,97 @@
+package istanbul
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidJSONErrors(t *testing.T) {
+	_, err := New().TransformCoverage(`{"a.js": {"path": }}`)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+
+	var jsonErr *JSONError
+	require.ErrorAs(t, err, &jsonErr)
+	assert.Equal(t, int64(19), jsonErr.Offset)
+
+	err = ValidateCoverageData([]byte(`{"a.js": {"path": 1}}`))
+	require.ErrorAs(t, err, &jsonErr)
+	assert.Positive(t, jsonErr.Offset)
+
+	err = DecodeCoverage(strings.NewReader(`[]`), func(string, *FileCoverage) error { return nil })
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+
+	_, err = MergeCoverageBytes([]byte(`{}`), []byte(`nope`))
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+}
+
+func TestInvalidSourceMapErrors(t *testing.T) {
+	broken := &SourceMap{Version: 3, Sources: []string{"a.ts"}, Mappings: "A!AA"}
+
+	// Direct lookups do not know the coverage file
+	_, err := NewSourceMapTransformer().GetOriginalPosition(broken, Position{Line: 1})
+	var smErr *SourceMapError
+	require.ErrorAs(t, err, &smErr)
+	assert.Empty(t, smErr.File)
+	assert.ErrorIs(t, err, ErrInvalidSourceMap)
+
+	// Transforms fail with the key of the generated file
+	fc := largeBundleCoverage(3)["dist/bundle.js"]
+	fc.InputSourceMap = broken
+	_, err = NewCoverageTransformer().Transform(CoverageMap{fc.Path: fc})
+	require.ErrorAs(t, err, &smErr)
+	assert.Equal(t, "dist/bundle.js", smErr.File)
+	assert.ErrorIs(t, err, ErrInvalidSourceMap)
+	assert.Contains(t, err.Error(), "invalid source map for dist/bundle.js")
+
+	// The file is named by its key when the path differs
+	_, err = NewCoverageTransformer().Transform(CoverageMap{"bundle-key.js": fc})
+	require.ErrorAs(t, err, &smErr)
+	assert.Equal(t, "bundle-key.js", smErr.File)
+
+	// So do index maps with a section without map
+	fc.InputSourceMap = &SourceMap{Version: 3, Sections: []SourceMapSection{{}}}
+	_, err = NewCoverageTransformer().Transform(CoverageMap{fc.Path: fc})
+	assert.ErrorIs(t, err, ErrInvalidSourceMap)
+}
+
+func TestNoMappingErrors(t *testing.T) {
+	smt := NewSourceMapTransformer()
+	sm := testSourceMap("src/a.ts")
+
+	_, err := smt.GetOriginalPosition(sm, Position{Line: 10})
+	assert.ErrorIs(t, err, ErrNoMapping)
+	assert.EqualError(t, err, "no mapping found for position 10:0")
+
+	_, err = smt.OriginalPositionFor(sm, Position{Line: 10}, LookupOptions{})
+	assert.ErrorIs(t, err, ErrNoMapping)
+
+	// In strict mode the mapping error wraps the lookup error
+	_, err = NewCoverageTransformer(WithStrict()).Transform(reportCoverage())
+	assert.ErrorIs(t, err, ErrUnmappable)
+	assert.ErrorIs(t, err, ErrNoMapping)
+}
+
+func TestValidationErrors(t *testing.T) {
+	err := ValidateCoverageData([]byte(`{"b.js": {"path": "b.js"}, "a.js": null}`))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidCoverage)
+	assert.False(t, errors.Is(err, ErrInvalidJSON))
+
+	// Files are checked in path order
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, &ValidationError{File: "a.js", Msg: "null coverage data", Pointer: "/a.js"}, validationErr)
+
+	err = ValidateCoverageData([]byte(`{"b.js": {"path": "b.js"}}`))
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "statementMap", validationErr.Field)
+	assert.EqualError(t, validationErr, "invalid coverage at /b.js/statementMap: missing")
+
+	assert.EqualError(t, &ValidationError{File: "a.js", Field: "s", ID: "3", Msg: "negative hit count"},
+		"invalid coverage for file a.js, field s, id 3: negative hit count")
+}
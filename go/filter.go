@@ -0,0 +1,163 @@
+package istanbul
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// globMatcher matches slash-separated paths against include and exclude globs
+type globMatcher struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newGlobMatcher compiles include and exclude glob patterns
+func newGlobMatcher(include, exclude []string) *globMatcher {
+	gm := &globMatcher{}
+	for _, pattern := range include {
+		gm.include = append(gm.include, compileGlob(pattern))
+	}
+	for _, pattern := range exclude {
+		gm.exclude = append(gm.exclude, compileGlob(pattern))
+	}
+	return gm
+}
+
+// Match reports whether p matches an include pattern (or there are none)
+// and no exclude pattern
+func (gm *globMatcher) Match(p string) bool {
+	p = filepath.ToSlash(p)
+
+	if len(gm.include) > 0 && !matchAny(gm.include, p) {
+		return false
+	}
+	return !matchAny(gm.exclude, p)
+}
+
+// matchAny reports whether any of the patterns matches p
+func matchAny(patterns []*regexp.Regexp, p string) bool {
+	for _, re := range patterns {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileGlob converts a glob into a regular expression matching the whole
+// path. "**" matches any number of path segments, "*" and "?" never cross
+// "/", "[...]" is a character class and "{a,b}" matches either alternative.
+// Malformed classes and braces are matched literally.
+func compileGlob(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+
+	groups := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end <= 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			b.WriteByte('[')
+			if class[0] == '!' || class[0] == '^' {
+				b.WriteByte('^')
+				class = class[1:]
+			}
+			for _, r := range class {
+				if r == '-' {
+					b.WriteRune(r)
+				} else {
+					b.WriteString(regexp.QuoteMeta(string(r)))
+				}
+			}
+			b.WriteByte(']')
+			i += end + 1
+		case '{':
+			groups++
+			b.WriteString("(?:")
+		case '}':
+			if groups > 0 {
+				groups--
+				b.WriteString(")")
+			} else {
+				b.WriteString(`\}`)
+			}
+		case ',':
+			if groups > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString(strings.Repeat(")", groups))
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		// Fall back to matching the pattern literally
+		return regexp.MustCompile("^" + regexp.QuoteMeta(pattern) + "$")
+	}
+	return re
+}
+
+// includePath reports whether an output path passes the include and exclude
+// filters of the transformer
+func (ct *CoverageTransformer) includePath(p string) bool {
+	return ct.filter == nil || ct.filter.Match(p)
+}
+
+// ignoredSources collects the sources listed in the ignoreList (or the older
+// x_google_ignoreList) of a source map and of all its sections
+func ignoredSources(sm *SourceMap) map[string]bool {
+	ignored := make(map[string]bool)
+	collectIgnoredSources(sm, ignored)
+	return ignored
+}
+
+// collectIgnoredSources adds the ignored sources of sm to ignored
+func collectIgnoredSources(sm *SourceMap, ignored map[string]bool) {
+	if sm == nil {
+		return
+	}
+	for _, section := range sm.Sections {
+		collectIgnoredSources(section.Map, ignored)
+	}
+
+	indices := sm.IgnoreList
+	if len(indices) == 0 {
+		if raw, ok := sm.Extensions["x_google_ignoreList"]; ok {
+			_ = json.Unmarshal(raw, &indices) // Ignore malformed lists
+		}
+	}
+
+	for _, idx := range indices {
+		if idx >= 0 && idx < len(sm.Sources) {
+			ignored[joinSourceRoot(sm.SourceRoot, sm.Sources[idx])] = true
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package istanbul
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"src/**", "src/a/b.ts", true},
+		{"src/**", "lib/a.ts", false},
+		{"**/*.ts", "a.ts", true},
+		{"**/*.ts", "src/deep/a.ts", true},
+		{"**/*.ts", "src/a.js", false},
+		{"src/*.ts", "src/a.ts", true},
+		{"src/*.ts", "src/deep/a.ts", false},
+		{"**/node_modules/**", "node_modules/lodash/index.js", true},
+		{"**/node_modules/**", "/app/node_modules/lodash/index.js", true},
+		{"src/?.ts", "src/a.ts", true},
+		{"src/?.ts", "src/ab.ts", false},
+		{"src/[abc].ts", "src/b.ts", true},
+		{"src/[!abc].ts", "src/b.ts", false},
+		{"src/*.{ts,tsx}", "src/app.tsx", true},
+		{"src/*.{ts,tsx}", "src/app.js", false},
+		{"webpack/runtime/*", "webpack/runtime/chunk", true},
+		{"src/a+b (1).ts", "src/a+b (1).ts", true},
+		{"src/[.ts", "src/[.ts", true},
+		{"src/{a.ts", "src/a.ts", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.match, compileGlob(tt.pattern).MatchString(tt.path))
+		})
+	}
+}
+
+func TestTransformWithIncludeExclude(t *testing.T) {
+	coverage := filterCoverageFixture(t)
+
+	transformer := NewCoverageTransformer(
+		WithInclude("src/**"),
+		WithExclude("**/*.spec.ts"),
+	)
+	result, err := transformer.Transform(coverage)
+	require.NoError(t, err)
+
+	assert.Contains(t, result, filepath.Join("src", "app.ts"))
+	assert.NotContains(t, result, filepath.Join("src", "app.spec.ts"))
+	assert.NotContains(t, result, filepath.Join("node_modules", "lib", "index.js"))
+	assert.NotContains(t, result, filepath.Join("webpack", "bootstrap"))
+}
+
+func TestTransformWithIgnoreList(t *testing.T) {
+	coverage := filterCoverageFixture(t)
+
+	// Without the option every source is kept
+	result, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+	assert.Len(t, result, 4)
+
+	result, err = NewCoverageTransformer(WithIgnoreList()).Transform(coverage)
+	require.NoError(t, err)
+	assert.Contains(t, result, filepath.Join("src", "app.ts"))
+	assert.Contains(t, result, filepath.Join("src", "app.spec.ts"))
+	assert.NotContains(t, result, filepath.Join("node_modules", "lib", "index.js"))
+	assert.NotContains(t, result, filepath.Join("webpack", "bootstrap"))
+}
+
+// filterCoverageFixture builds a bundle mapping one statement to each of
+// four sources, two of which are in the source map ignore lists
+func filterCoverageFixture(t *testing.T) CoverageMap {
+	coverageData := `{
+		"dist/bundle.js": {
+			"path": "dist/bundle.js",
+			"statementMap": {
+				"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 10}},
+				"1": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 10}},
+				"2": {"start": {"line": 3, "column": 0}, "end": {"line": 3, "column": 10}},
+				"3": {"start": {"line": 4, "column": 0}, "end": {"line": 4, "column": 10}}
+			},
+			"fnMap": {},
+			"branchMap": {},
+			"s": {"0": 1, "1": 1, "2": 1, "3": 1},
+			"f": {},
+			"b": {},
+			"inputSourceMap": {
+				"version": 3,
+				"sections": [
+					{"offset": {"line": 0, "column": 0}, "map": {
+						"version": 3,
+						"sources": ["webpack:///./src/app.ts", "webpack:///./src/app.spec.ts", "webpack:///./node_modules/lib/index.js"],
+						"names": [],
+						"mappings": "AAAA;ACAA;ACAA",
+						"ignoreList": [2]
+					}},
+					{"offset": {"line": 3, "column": 0}, "map": {
+						"version": 3,
+						"sources": ["webpack:///webpack/bootstrap"],
+						"names": [],
+						"mappings": "AAAA",
+						"x_google_ignoreList": [0]
+					}}
+				]
+			}
+		}
+	}`
+
+	coverage, err := ParseCoverageMap([]byte(coverageData))
+	require.NoError(t, err)
+	return coverage
+}
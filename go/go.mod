@@ -2,10 +2,7 @@ module github.com/canyon-project/istanbul-source-maps/go
 
 go 1.22
 
-require (
-	github.com/go-sourcemap/sourcemap v2.1.4+incompatible
-	github.com/stretchr/testify v1.9.0
-)
+require github.com/stretchr/testify v1.9.0
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
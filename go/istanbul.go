@@ -2,8 +2,9 @@
 package istanbul
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 )
 
 // Istanbul provides the main API for coverage transformation
@@ -12,42 +13,75 @@ type Istanbul struct {
 }
 
 // New creates a new Istanbul instance
-func New() *Istanbul {
+func New(opts ...Option) *Istanbul {
 	return &Istanbul{
-		transformer: NewCoverageTransformer(),
+		transformer: NewCoverageTransformer(opts...),
 	}
 }
 
 // TransformCoverage transforms Istanbul coverage data using source maps
 func (i *Istanbul) TransformCoverage(coverageData string) (string, error) {
+	return i.TransformCoverageContext(context.Background(), coverageData)
+}
+
+// TransformCoverageContext transforms Istanbul coverage data using source
+// maps, stopping with a *CanceledError when ctx is done
+func (i *Istanbul) TransformCoverageContext(ctx context.Context, coverageData string) (string, error) {
+	result, _, err := i.transformCoverageBytes(ctx, []byte(coverageData))
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// TransformCoverageBytes transforms Istanbul coverage data from bytes
+func (i *Istanbul) TransformCoverageBytes(coverageData []byte) ([]byte, error) {
+	result, _, err := i.transformCoverageBytes(context.Background(), coverageData)
+	return result, err
+}
+
+// TransformCoverageWithReport transforms Istanbul coverage data and reports
+// how many statements, functions and branches of each generated file were
+// mapped or dropped
+func (i *Istanbul) TransformCoverageWithReport(ctx context.Context, coverageData []byte) ([]byte, *TransformReport, error) {
+	return i.transformCoverageBytes(ctx, coverageData)
+}
+
+// TransformStream transforms the Istanbul coverage JSON read from r and
+// writes the result to w, one file entry at a time. Entries without a source
+// map are written as they are read; only the transformed coverage is kept
+// until the input ends. See CoverageTransformer.TransformStream.
+func (i *Istanbul) TransformStream(ctx context.Context, r io.Reader, w io.Writer) error {
+	return i.transformer.TransformStream(ctx, r, w)
+}
+
+// transformCoverageBytes parses, transforms and serializes coverage data
+func (i *Istanbul) transformCoverageBytes(ctx context.Context, coverageData []byte) ([]byte, *TransformReport, error) {
 	// Parse input JSON
-	coverage, err := ParseCoverageMap([]byte(coverageData))
+	coverage, err := ParseCoverageMap(coverageData)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse coverage data: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse coverage data: %w", err)
 	}
 
 	// Transform coverage
-	transformed, err := i.transformer.Transform(coverage)
+	transformed, report, err := i.transformer.TransformWithReport(ctx, coverage)
 	if err != nil {
-		return "", fmt.Errorf("failed to transform coverage: %w", err)
+		return nil, nil, fmt.Errorf("failed to transform coverage: %w", err)
 	}
 
 	// Convert back to JSON
 	result, err := transformed.ToJSON()
 	if err != nil {
-		return "", fmt.Errorf("failed to serialize result: %w", err)
+		return nil, nil, fmt.Errorf("failed to serialize result: %w", err)
 	}
 
-	return string(result), nil
+	return result, report, nil
 }
 
-// TransformCoverageBytes transforms Istanbul coverage data from bytes
-func (i *Istanbul) TransformCoverageBytes(coverageData []byte) ([]byte, error) {
-	result, err := i.TransformCoverage(string(coverageData))
-	if err != nil {
-		return nil, err
-	}
-	return []byte(result), nil
+// Cache returns the cache of parsed source maps, which can be shared with
+// other instances through WithCache
+func (i *Istanbul) Cache() *ConsumerCache {
+	return i.transformer.Cache()
 }
 
 // GetVersion returns the version of this library
@@ -74,31 +108,32 @@ func TransformCoverageBytes(coverageData []byte) ([]byte, error) {
 	return istanbul.TransformCoverageBytes(coverageData)
 }
 
-// ValidateCoverageData validates that the input is valid Istanbul coverage data
-func ValidateCoverageData(data []byte) error {
-	var coverage CoverageMap
-	if err := json.Unmarshal(data, &coverage); err != nil {
-		return fmt.Errorf("invalid JSON: %w", err)
+// MergeCoverageBytes merges several Istanbul coverage JSON documents, such
+// as the outputs of sharded test runs, into one
+func MergeCoverageBytes(reports ...[]byte) ([]byte, error) {
+	result := make(CoverageMap)
+	for i, data := range reports {
+		coverage, err := ParseCoverageMap(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse coverage report %d: %w", i, err)
+		}
+		result.Merge(coverage)
 	}
 
-	// Basic validation
-	for filePath, fc := range coverage {
-		if fc == nil {
-			return fmt.Errorf("null coverage data for file: %s", filePath)
-		}
-		if fc.Path == "" {
-			return fmt.Errorf("missing path in coverage data for file: %s", filePath)
-		}
-		if fc.StatementMap == nil {
-			return fmt.Errorf("missing statementMap for file: %s", filePath)
-		}
-		if fc.FnMap == nil {
-			return fmt.Errorf("missing fnMap for file: %s", filePath)
-		}
-		if fc.BranchMap == nil {
-			return fmt.Errorf("missing branchMap for file: %s", filePath)
-		}
+	return result.ToJSON()
+}
+
+// ValidateCoverageData validates that the input is valid Istanbul coverage
+// data. Malformed JSON returns a *JSONError; otherwise every problem found is
+// returned at once as ValidationErrors.
+func ValidateCoverageData(data []byte) error {
+	coverage, err := ParseCoverageMap(data)
+	if err != nil {
+		return err
 	}
 
+	if errs := validateCoverage(coverage); len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
@@ -1,7 +1,12 @@
 package istanbul
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -188,7 +193,161 @@ func TestTransformCoverageInvalidInput(t *testing.T) {
 	assert.Empty(t, result)
 }
 
+func TestTransformLargeBundleAssignsContiguousIDs(t *testing.T) {
+	const n = 1000
+
+	result, err := NewCoverageTransformer().Transform(largeBundleCoverage(n))
+	require.NoError(t, err)
+
+	app := result[filepath.Join("src", "app.ts")]
+	require.NotNil(t, app)
+	require.Len(t, app.StatementMap, n)
+	require.Len(t, app.FnMap, n/10)
+	for i := 0; i < n; i++ {
+		assert.Contains(t, app.StatementMap, fmt.Sprint(i))
+	}
+}
+
 // Benchmark tests
+func TestTransformWithWorkersMatchesSequential(t *testing.T) {
+	// Several bundles sharing one original source, so workers merge into the
+	// same output file
+	coverage := make(CoverageMap)
+	for i := 0; i < 8; i++ {
+		fc := largeBundleCoverage(50)["dist/bundle.js"]
+		fc.Path = fmt.Sprintf("dist/chunk%d/bundle.js", i%2) + strings.Repeat("x", i)
+		coverage[fc.Path] = fc
+	}
+	coverage["plain.js"] = &FileCoverage{Path: "plain.js"}
+
+	sequential, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+	parallel, err := NewCoverageTransformer(WithWorkers(4)).Transform(coverage)
+	require.NoError(t, err)
+
+	want, err := sequential.ToJSON()
+	require.NoError(t, err)
+	got, err := parallel.ToJSON()
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestWithWorkersDefaultsToCPUs(t *testing.T) {
+	opts := newTransformOptions([]Option{WithWorkers(0)})
+	assert.Equal(t, runtime.GOMAXPROCS(0), opts.Workers)
+	assert.Equal(t, 1, newTransformOptions(nil).Workers)
+}
+
+// cancelAfterContext reports cancellation after its Err method has been
+// called n times
+type cancelAfterContext struct {
+	context.Context
+	calls, n int
+}
+
+func (c *cancelAfterContext) Err() error {
+	c.calls++
+	if c.calls > c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestTransformContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, workers := range []int{1, 4} {
+		_, err := NewCoverageTransformer(WithWorkers(workers)).TransformContext(ctx, largeBundleCoverage(10))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		var canceled *CanceledError
+		require.ErrorAs(t, err, &canceled)
+		assert.Equal(t, 0, canceled.Completed)
+		assert.Equal(t, 1, canceled.Total)
+	}
+}
+
+func TestTransformContextCanceledWithinFile(t *testing.T) {
+	// Canceled after the check before the file and the first statement
+	// check, so only the periodic check inside the statement loop stops it
+	ctx := &cancelAfterContext{Context: context.Background(), n: 2}
+
+	_, err := NewCoverageTransformer().TransformContext(ctx, largeBundleCoverage(2*cancelCheckInterval))
+	var canceled *CanceledError
+	require.ErrorAs(t, err, &canceled)
+	assert.Equal(t, "transform canceled after 0 of 1 files: context canceled", canceled.Error())
+}
+
+func TestTransformCoverageContext(t *testing.T) {
+	data, err := json.Marshal(largeBundleCoverage(10))
+	require.NoError(t, err)
+
+	result, err := New().TransformCoverageContext(context.Background(), string(data))
+	require.NoError(t, err)
+	assert.Contains(t, result, "app.ts")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, err = New().TransformCoverageContext(ctx, string(data))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = TransformCoverageContext(ctx, data)
+	var canceled *CanceledError
+	assert.ErrorAs(t, err, &canceled)
+}
+
+func TestFileCoverageHashesRoundTrip(t *testing.T) {
+	input := `{"src/a.js":{"path":"src/a.js","statementMap":{},"fnMap":{},"branchMap":{},"s":{},"f":{},"b":{},` +
+		`"_coverageSchema":"1a1c01bbd47fc00a2c39e90264f33305804495a9",` +
+		`"hash":"5a2f3f3e1b0e1c57a52f0c5a5b0b0c2e9f0f4a1d","contentHash":"c0ffee"}}`
+
+	coverage, err := ParseCoverageMap([]byte(input))
+	require.NoError(t, err)
+	fc := coverage["src/a.js"]
+	assert.Equal(t, "1a1c01bbd47fc00a2c39e90264f33305804495a9", fc.CoverageSchema)
+	assert.Equal(t, "5a2f3f3e1b0e1c57a52f0c5a5b0b0c2e9f0f4a1d", fc.Hash)
+	assert.Equal(t, "c0ffee", fc.ContentHash)
+
+	// Hashes follow the coverage maps as in istanbul output
+	output, err := json.Marshal(coverage)
+	require.NoError(t, err)
+	assert.Equal(t, input, string(output))
+
+	// Files without a source map keep their hashes through a transform
+	result, err := TransformCoverage([]byte(input))
+	require.NoError(t, err)
+	assert.Contains(t, string(result), `"hash": "5a2f3f3e1b0e1c57a52f0c5a5b0b0c2e9f0f4a1d"`)
+}
+
+func TestTransformComputesHashes(t *testing.T) {
+	coverage := largeBundleCoverage(10)
+	coverage["dist/bundle.js"].CoverageSchema = "332fd63041d2c1bcb487cc26dd0d5f7d97098a6c"
+	coverage["dist/bundle.js"].Hash = "generated"
+
+	result, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+	fc := result[filepath.Join("src", "app.ts")]
+	require.NotNil(t, fc)
+
+	// The schema of the generated file is kept, the hash is new
+	assert.Equal(t, "332fd63041d2c1bcb487cc26dd0d5f7d97098a6c", fc.CoverageSchema)
+	assert.Regexp(t, "^[0-9a-f]{40}$", fc.Hash)
+	assert.Empty(t, fc.ContentHash)
+
+	// The hash identifies the structure, not the hits
+	again, err := NewCoverageTransformer().Transform(largeBundleCoverage(10))
+	require.NoError(t, err)
+	other := again[filepath.Join("src", "app.ts")]
+	assert.Equal(t, defaultCoverageSchema, other.CoverageSchema)
+	assert.Equal(t, fc.Hash, other.Hash)
+
+	other.S["0"]++
+	assert.Equal(t, fc.Hash, other.computeHash())
+	other.StatementMap["0"] = Location{Start: Position{Line: 1}, End: Position{Line: 1, Column: 1}}
+	assert.NotEqual(t, fc.Hash, other.computeHash())
+}
+
 func BenchmarkTransformCoverage(b *testing.B) {
 	istanbul := New()
 	coverageData := `{
@@ -221,3 +380,75 @@ func BenchmarkTransformCoverage(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkTransformLargeBundle transforms synthetic bundles of growing size;
+// ns/statement should stay flat as the transform is linear in bundle size
+func BenchmarkTransformLargeBundle(b *testing.B) {
+	for _, n := range []int{1000, 10000, 80000} {
+		coverage := largeBundleCoverage(n)
+
+		b.Run(fmt.Sprintf("statements=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewCoverageTransformer().Transform(coverage); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/statement")
+		})
+	}
+}
+
+// largeBundleCoverage builds a bundle with one statement per generated line,
+// each mapped to its own line in src/app.ts, and a function every 10 lines
+func largeBundleCoverage(n int) CoverageMap {
+	fc := &FileCoverage{
+		Path:         "dist/bundle.js",
+		StatementMap: make(map[string]Location, n),
+		FnMap:        make(map[string]FunctionMeta, n/10),
+		BranchMap:    make(map[string]BranchMeta),
+		S:            make(map[string]int, n),
+		F:            make(map[string]int, n/10),
+		B:            make(map[string][]int),
+	}
+
+	for i := 0; i < n; i++ {
+		id := fmt.Sprint(i)
+		loc := Location{Start: Position{Line: i + 1, Column: 0}, End: Position{Line: i + 1, Column: 20}}
+		fc.StatementMap[id] = loc
+		fc.S[id] = i % 3
+		if i%10 == 0 {
+			fnID := fmt.Sprint(i / 10)
+			fc.FnMap[fnID] = FunctionMeta{Name: "fn" + fnID, Decl: loc, Loc: loc}
+			fc.F[fnID] = 1
+		}
+	}
+
+	// Each line maps column 0 to the next original line and column 10 to
+	// column 10 of the same line
+	fc.InputSourceMap = &SourceMap{
+		Version:  3,
+		Sources:  []string{"../src/app.ts"},
+		Names:    []string{},
+		Mappings: "AAAA,UAAU" + strings.Repeat(";AACV,UAAU", n-1),
+	}
+
+	return CoverageMap{fc.Path: fc}
+}
+
+func TestTransformSkipsNullEntries(t *testing.T) {
+	coverage := largeBundleCoverage(3)
+	coverage["null.js"] = nil
+
+	for _, workers := range []int{1, 4} {
+		result, report, err := NewCoverageTransformer(WithWorkers(workers)).TransformWithReport(context.Background(), coverage)
+		require.NoError(t, err)
+		assert.NotContains(t, result, "null.js")
+		assert.NotContains(t, report.Files, "null.js")
+	}
+
+	data, err := json.Marshal(coverage)
+	require.NoError(t, err)
+	_, err = New().TransformCoverageBytes(data)
+	assert.NoError(t, err)
+}
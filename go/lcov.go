@@ -0,0 +1,94 @@
+package istanbul
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteLCOV writes the coverage map as an LCOV tracefile (lcov.info), with
+// the same records as the lcovonly reporter of istanbul: functions, line hits
+// derived from the statements and branch hits for each file. Files are
+// written in path order under their FileCoverage path.
+func (cm CoverageMap) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, key := range sortedPaths(cm) {
+		if fc := cm[key]; fc != nil {
+			writeLCOVFile(bw, key, fc)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeLCOVFile writes the record of one file
+func writeLCOVFile(w *bufio.Writer, key string, fc *FileCoverage) {
+	record := func(name string, values ...string) {
+		w.WriteString(name)
+		w.WriteByte(':')
+		w.WriteString(strings.Join(values, ","))
+		w.WriteByte('\n')
+	}
+	itoa := strconv.Itoa
+
+	record("TN")
+	record("SF", fc.pathOr(key))
+
+	// Functions, declared where istanbul reports them
+	fnIDs := sortedIDs(fc.FnMap)
+	for _, id := range fnIDs {
+		fn := fc.FnMap[id]
+		line := fn.Decl.Start.Line
+		if line == 0 {
+			line = fn.Loc.Start.Line // Some instrumenters only set loc
+		}
+		record("FN", itoa(line), fn.Name)
+	}
+	fnHit := 0
+	for _, hits := range fc.F {
+		if hits > 0 {
+			fnHit++
+		}
+	}
+	record("FNF", itoa(len(fc.F)))
+	record("FNH", itoa(fnHit))
+	for _, id := range fnIDs {
+		record("FNDA", itoa(fc.F[id]), fc.FnMap[id].Name)
+	}
+
+	// Lines
+	lines := fc.LineCoverage()
+	lineHit := 0
+	for _, line := range sortedLines(lines) {
+		record("DA", itoa(line), itoa(lines[line]))
+		if lines[line] > 0 {
+			lineHit++
+		}
+	}
+	record("LF", itoa(len(lines)))
+	record("LH", itoa(lineHit))
+
+	// Branches, one entry per branch location
+	branchTotal, branchHit := 0, 0
+	for _, id := range sortedIDs(fc.B) {
+		hits := fc.B[id]
+		branchTotal += len(hits)
+		for _, h := range hits {
+			if h > 0 {
+				branchHit++
+			}
+		}
+
+		branch, exists := fc.BranchMap[id]
+		if !exists {
+			continue
+		}
+		for i, h := range hits {
+			record("BRDA", itoa(branch.Loc.Start.Line), id, itoa(i), itoa(h))
+		}
+	}
+	record("BRF", itoa(branchTotal))
+	record("BRH", itoa(branchHit))
+
+	w.WriteString("end_of_record\n")
+}
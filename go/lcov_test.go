@@ -0,0 +1,79 @@
+package istanbul
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reporterCoverage is a small file with two functions, statements sharing a
+// line and an if without else
+func reporterCoverage() CoverageMap {
+	loc := func(startLine, startCol, endLine, endCol int) Location {
+		return Location{Start: Position{Line: startLine, Column: startCol}, End: Position{Line: endLine, Column: endCol}}
+	}
+
+	return CoverageMap{
+		"src/b.ts": {Path: "src/b.ts", S: map[string]int{}, F: map[string]int{}, B: map[string][]int{},
+			StatementMap: map[string]Location{}, FnMap: map[string]FunctionMeta{}, BranchMap: map[string]BranchMeta{}},
+		"src/a.ts": {
+			Path: "src/a.ts",
+			StatementMap: map[string]Location{
+				"0":  loc(1, 0, 3, 1),
+				"1":  loc(2, 2, 2, 10),
+				"2":  loc(2, 11, 2, 20),
+				"3":  loc(5, 0, 7, 1),
+				"4":  loc(6, 2, 6, 12),
+				"10": loc(8, 0, 8, 5),
+			},
+			S: map[string]int{"0": 1, "1": 0, "2": 3, "3": 1, "4": 0, "10": 2},
+			FnMap: map[string]FunctionMeta{
+				"0": {Name: "alpha", Decl: loc(1, 9, 1, 14), Loc: loc(1, 17, 3, 1)},
+				"1": {Name: "beta", Loc: loc(5, 0, 7, 1)},
+			},
+			F: map[string]int{"0": 4, "1": 0},
+			BranchMap: map[string]BranchMeta{
+				"0": {Type: "if", Loc: loc(6, 2, 6, 12), Locations: []Location{loc(6, 2, 6, 12), loc(6, 2, 6, 12)}},
+			},
+			B: map[string][]int{"0": {0, 1}},
+		},
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, reporterCoverage().WriteLCOV(&buf))
+
+	assert.Equal(t, `TN:
+SF:src/a.ts
+FN:1,alpha
+FN:5,beta
+FNF:2
+FNH:1
+FNDA:4,alpha
+FNDA:0,beta
+DA:1,1
+DA:2,3
+DA:5,1
+DA:6,0
+DA:8,2
+LF:5
+LH:4
+BRDA:6,0,0,0
+BRDA:6,0,1,1
+BRF:2
+BRH:1
+end_of_record
+TN:
+SF:src/b.ts
+FNF:0
+FNH:0
+LF:0
+LH:0
+BRF:0
+BRH:0
+end_of_record
+`, buf.String())
+}
@@ -0,0 +1,88 @@
+package istanbul
+
+import (
+	"math"
+	"sort"
+)
+
+// BranchLineCoverage holds the coverage of the branch locations of the
+// branches starting on one line
+type BranchLineCoverage struct {
+	Covered int
+	Total   int
+	// Coverage is the covered percentage, not rounded
+	Coverage float64
+}
+
+// LineCoverage returns the hits of each line with statements, as the maximum
+// hits of the statements starting on it. Hits of unknown statements are
+// ignored. Like getLineCoverage in istanbul-lib-coverage.
+func (fc *FileCoverage) LineCoverage() map[int]int {
+	lines := make(map[int]int)
+	for id, hits := range fc.S {
+		loc, exists := fc.StatementMap[id]
+		if !exists {
+			continue
+		}
+		if prev, seen := lines[loc.Start.Line]; !seen || prev < hits {
+			lines[loc.Start.Line] = hits
+		}
+	}
+	return lines
+}
+
+// UncoveredLines returns the lines with statements that were never hit, in
+// ascending order. Like getUncoveredLines in istanbul-lib-coverage.
+func (fc *FileCoverage) UncoveredLines() []int {
+	lines := fc.LineCoverage()
+	result := []int{}
+	for _, line := range sortedLines(lines) {
+		if lines[line] == 0 {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// BranchCoverageByLine pools the locations of the branches starting on each
+// line. Branches without hits or locations are ignored. Like
+// getBranchCoverageByLine in istanbul-lib-coverage.
+func (fc *FileCoverage) BranchCoverageByLine() map[int]BranchLineCoverage {
+	result := make(map[int]BranchLineCoverage)
+	for id, hits := range fc.B {
+		branch, exists := fc.BranchMap[id]
+		if !exists || len(hits) == 0 {
+			continue
+		}
+		line := branch.Loc.Start.Line
+		c := result[line]
+		for _, h := range hits {
+			c.Total++
+			if h > 0 {
+				c.Covered++
+			}
+		}
+		c.Coverage = float64(c.Covered) / float64(c.Total) * 100
+		result[line] = c
+	}
+	return result
+}
+
+// sortedLines returns the line numbers of lines in ascending order
+func sortedLines(lines map[int]int) []int {
+	result := make([]int, 0, len(lines))
+	for line := range lines {
+		result = append(result, line)
+	}
+	sort.Ints(result)
+	return result
+}
+
+// percent returns covered/total as a percentage truncated to two decimals,
+// or 100 when there is nothing to cover, as istanbul-lib-coverage does
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return math.Floor(float64(covered)*100000/float64(total)/10) / 100
+}
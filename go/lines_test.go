@@ -0,0 +1,39 @@
+package istanbul
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineCoverage(t *testing.T) {
+	fc := reporterCoverage()["src/a.ts"]
+	fc.S["99"] = 7 // Hits without a statement are ignored
+
+	// Line 2 has statements hit 0 and 3 times
+	assert.Equal(t, map[int]int{1: 1, 2: 3, 5: 1, 6: 0, 8: 2}, fc.LineCoverage())
+	assert.Empty(t, reporterCoverage()["src/b.ts"].LineCoverage())
+}
+
+func TestUncoveredLines(t *testing.T) {
+	fc := reporterCoverage()["src/a.ts"]
+	assert.Equal(t, []int{6}, fc.UncoveredLines())
+
+	fc.S["0"] = 0
+	assert.Equal(t, []int{1, 6}, fc.UncoveredLines())
+	assert.Equal(t, []int{}, reporterCoverage()["src/b.ts"].UncoveredLines())
+}
+
+func TestBranchCoverageByLine(t *testing.T) {
+	fc := reporterCoverage()["src/a.ts"]
+	assert.Equal(t, map[int]BranchLineCoverage{6: {Covered: 1, Total: 2, Coverage: 50}}, fc.BranchCoverageByLine())
+
+	// Branches starting on the same line are pooled
+	fc.BranchMap["1"] = BranchMeta{Type: "cond-expr", Loc: fc.BranchMap["0"].Loc, Locations: make([]Location, 1)}
+	fc.B["1"] = []int{0}
+	fc.B["2"] = []int{1} // Hits without a branch are ignored
+	got := fc.BranchCoverageByLine()
+	assert.Equal(t, 1, got[6].Covered)
+	assert.Equal(t, 3, got[6].Total)
+	assert.InDelta(t, 33.33, got[6].Coverage, 0.01)
+}
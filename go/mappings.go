@@ -0,0 +1,297 @@
+package istanbul
+
+import (
+	"fmt"
+	"sort"
+)
+
+// mapping represents a single decoded segment of a source map.
+// Lines are one-based and columns zero-based, as in istanbul locations.
+type mapping struct {
+	genLine    int
+	genColumn  int
+	source     int // -1 when the segment has no original source
+	origLine   int
+	origColumn int
+	name       int // -1 when the segment has no name
+}
+
+// sourceMapConsumer answers position queries against a flat source map
+type sourceMapConsumer struct {
+	sources   []string
+	names     []string
+	generated []mapping // sorted by generated position
+	original  []mapping // sorted by original position, mapped segments only
+}
+
+// newSourceMapConsumer decodes a flat (non-indexed) source map
+func newSourceMapConsumer(sm *SourceMap) (*sourceMapConsumer, error) {
+	if sm.Version != 3 && sm.Version != 0 {
+		return nil, fmt.Errorf("unsupported source map version %d", sm.Version)
+	}
+
+	generated, err := decodeMappings(sm.Mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]string, len(sm.Sources))
+	for i, source := range sm.Sources {
+		sources[i] = joinSourceRoot(sm.SourceRoot, source)
+	}
+
+	// Segments of a line may be emitted out of order by some tools
+	sort.SliceStable(generated, func(i, j int) bool {
+		return compareGenerated(&generated[i], generated[j].genLine, generated[j].genColumn) < 0
+	})
+
+	original := make([]mapping, 0, len(generated))
+	for _, m := range generated {
+		if m.source >= 0 && m.source < len(sources) {
+			original = append(original, m)
+		}
+	}
+	sort.SliceStable(original, func(i, j int) bool {
+		return compareOriginal(&original[i], original[j].source, original[j].origLine, original[j].origColumn) < 0
+	})
+
+	return &sourceMapConsumer{
+		sources:   sources,
+		names:     sm.Names,
+		generated: generated,
+		original:  original,
+	}, nil
+}
+
+// originalPositionFor finds the segment on the given generated line closest
+// to column in the direction of b. Segments without a source never match.
+func (c *sourceMapConsumer) originalPositionFor(line, column int, b Bias) (*mapping, bool) {
+	var idx int
+	if b == LeastUpperBound {
+		idx = sort.Search(len(c.generated), func(i int) bool {
+			return compareGenerated(&c.generated[i], line, column) >= 0
+		})
+	} else {
+		idx = sort.Search(len(c.generated), func(i int) bool {
+			return compareGenerated(&c.generated[i], line, column) > 0
+		}) - 1
+	}
+
+	if idx < 0 || idx >= len(c.generated) {
+		return nil, false
+	}
+	m := &c.generated[idx]
+	if m.genLine != line || m.source < 0 || m.source >= len(c.sources) {
+		return nil, false
+	}
+	return m, true
+}
+
+// result converts a segment into a zero-width MappingResult
+func (c *sourceMapConsumer) result(m *mapping) *MappingResult {
+	original := Position{Line: m.origLine, Column: m.origColumn}
+	result := &MappingResult{
+		Source: c.sources[m.source],
+		Location: Location{
+			Start: original,
+			End:   original,
+		},
+	}
+	if m.name >= 0 && m.name < len(c.names) {
+		result.Name = c.names[m.name]
+	}
+	return result
+}
+
+// searchForward finds the first segment with an original source at or after
+// column on the given generated line
+func (c *sourceMapConsumer) searchForward(line, column int) (*mapping, bool) {
+	idx := sort.Search(len(c.generated), func(i int) bool {
+		return compareGenerated(&c.generated[i], line, column) >= 0
+	})
+	for ; idx < len(c.generated) && c.generated[idx].genLine == line; idx++ {
+		m := &c.generated[idx]
+		if m.source >= 0 && m.source < len(c.sources) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// originalPositionTryBoth looks up a position with greatest-lower-bound bias,
+// searching forward on the line when nothing precedes it
+func (c *sourceMapConsumer) originalPositionTryBoth(line, column int) (*mapping, bool) {
+	if m, ok := c.originalPositionFor(line, column, GreatestLowerBound); ok {
+		return m, true
+	}
+	return c.searchForward(line, column)
+}
+
+// generatedPositionFor finds the first segment at or after the given original
+// position within the same source
+func (c *sourceMapConsumer) generatedPositionFor(source, line, column int) (*mapping, bool) {
+	idx := sort.Search(len(c.original), func(i int) bool {
+		return compareOriginal(&c.original[i], source, line, column) >= 0
+	})
+	if idx >= len(c.original) || c.original[idx].source != source {
+		return nil, false
+	}
+	return &c.original[idx], true
+}
+
+// originalEndPositionFor computes the original end of a range ending at the
+// given generated position. The segment just before the end only tells where
+// the last original range starts, so the next original segment on the same
+// line is used to find where it stops. Without one the range extends to the
+// end of the line, with an EndOfLine column.
+func (c *sourceMapConsumer) originalEndPositionFor(line, column int) (*mapping, bool) {
+	beforeEnd, ok := c.originalPositionTryBoth(line, column-1)
+	if !ok {
+		return nil, false
+	}
+
+	possibleEnd, ok := c.generatedPositionFor(beforeEnd.source, beforeEnd.origLine, beforeEnd.origColumn+1)
+	if ok {
+		end, ok := c.originalPositionFor(possibleEnd.genLine, possibleEnd.genColumn, GreatestLowerBound)
+		if ok && end.source == beforeEnd.source && end.origLine == beforeEnd.origLine {
+			return end, true
+		}
+	}
+
+	toEndOfLine := *beforeEnd
+	toEndOfLine.origColumn = EndOfLine
+	return &toEndOfLine, true
+}
+
+// compareGenerated orders a segment against a generated position
+func compareGenerated(m *mapping, line, column int) int {
+	if m.genLine != line {
+		return m.genLine - line
+	}
+	return m.genColumn - column
+}
+
+// compareOriginal orders a segment against an original position
+func compareOriginal(m *mapping, source, line, column int) int {
+	if m.source != source {
+		return m.source - source
+	}
+	if m.origLine != line {
+		return m.origLine - line
+	}
+	return m.origColumn - column
+}
+
+// decodeMappings decodes a VLQ "mappings" string into segments
+func decodeMappings(mappings string) ([]mapping, error) {
+	var (
+		result     []mapping
+		line       = 1
+		column     int
+		source     int
+		origLine   int
+		origColumn int
+		name       int
+		fields     [5]int
+	)
+
+	for pos := 0; pos < len(mappings); {
+		switch mappings[pos] {
+		case ';':
+			line++
+			column = 0
+			pos++
+			continue
+		case ',':
+			pos++
+			continue
+		}
+
+		// Decode the fields of one segment
+		n := 0
+		for pos < len(mappings) && mappings[pos] != ',' && mappings[pos] != ';' {
+			if n == len(fields) {
+				return nil, fmt.Errorf("invalid mappings: segment with more than %d fields at offset %d", len(fields), pos)
+			}
+			value, next, err := decodeVLQ(mappings, pos)
+			if err != nil {
+				return nil, err
+			}
+			fields[n] = value
+			n++
+			pos = next
+		}
+
+		column += fields[0]
+		m := mapping{genLine: line, genColumn: column, source: -1, name: -1}
+
+		switch n {
+		case 1:
+		case 4, 5:
+			source += fields[1]
+			origLine += fields[2]
+			origColumn += fields[3]
+			m.source = source
+			m.origLine = origLine + 1
+			m.origColumn = origColumn
+			if n == 5 {
+				name += fields[4]
+				m.name = name
+			}
+		default:
+			return nil, fmt.Errorf("invalid mappings: segment with %d fields on line %d", n, line)
+		}
+
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// decodeVLQ decodes one base64 VLQ value starting at pos and returns it
+// together with the offset of the following character
+func decodeVLQ(s string, pos int) (value, next int, err error) {
+	var result, shift int
+	for {
+		if pos >= len(s) {
+			return 0, pos, fmt.Errorf("invalid mappings: unterminated VLQ value")
+		}
+		digit := base64Value(s[pos])
+		if digit < 0 {
+			return 0, pos, fmt.Errorf("invalid mappings: unexpected character %q at offset %d", s[pos], pos)
+		}
+		pos++
+
+		result += (digit & 31) << shift
+		if digit&32 == 0 {
+			break
+		}
+		shift += 5
+		if shift > 60 {
+			return 0, pos, fmt.Errorf("invalid mappings: VLQ value too large at offset %d", pos)
+		}
+	}
+
+	value = result >> 1
+	if result&1 == 1 {
+		value = -value
+	}
+	return value, pos, nil
+}
+
+// base64Value returns the value of a base64 digit, or -1 if invalid
+func base64Value(c byte) int {
+	switch {
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 26
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 52
+	case c == '+':
+		return 62
+	case c == '/':
+		return 63
+	}
+	return -1
+}
@@ -0,0 +1,217 @@
+package istanbul
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Merge adds the coverage of other into fc. Identical statements, functions
+// and branches (same location, name and type) have their hits summed, branch
+// hits element-wise; other items are appended with new IDs. The source map
+// and hashes of fc are kept, or taken from other if fc has none.
+func (fc *FileCoverage) Merge(other *FileCoverage) {
+	if other == nil {
+		return
+	}
+	fc.ensureMaps()
+	if fc.InputSourceMap == nil {
+		fc.InputSourceMap = other.InputSourceMap
+	}
+	if fc.CoverageSchema == "" {
+		fc.CoverageSchema = other.CoverageSchema
+	}
+	if fc.Hash == "" {
+		fc.Hash = other.Hash
+	}
+	if fc.ContentHash == "" {
+		fc.ContentHash = other.ContentHash
+	}
+	newCoverageIndex(fc).merge(other)
+}
+
+// Merge adds the coverage of other into cm, merging files present in both.
+// Files only in other are copied, so other is never modified. cm must not
+// be nil.
+func (cm CoverageMap) Merge(other CoverageMap) {
+	for _, path := range sortedPaths(other) {
+		fc := other[path]
+		if fc == nil {
+			continue
+		}
+		if existing, exists := cm[path]; exists && existing != nil {
+			existing.Merge(fc)
+		} else {
+			cm[path] = fc.clone()
+		}
+	}
+}
+
+// MergeCoverageMaps merges several coverage maps into a new one without
+// modifying them
+func MergeCoverageMaps(maps ...CoverageMap) CoverageMap {
+	result := make(CoverageMap)
+	for _, cm := range maps {
+		result.Merge(cm)
+	}
+	return result
+}
+
+// ensureMaps allocates any missing coverage maps so items can be added
+func (fc *FileCoverage) ensureMaps() {
+	if fc.StatementMap == nil {
+		fc.StatementMap = make(map[string]Location)
+	}
+	if fc.FnMap == nil {
+		fc.FnMap = make(map[string]FunctionMeta)
+	}
+	if fc.BranchMap == nil {
+		fc.BranchMap = make(map[string]BranchMeta)
+	}
+	if fc.S == nil {
+		fc.S = make(map[string]int)
+	}
+	if fc.F == nil {
+		fc.F = make(map[string]int)
+	}
+	if fc.B == nil {
+		fc.B = make(map[string][]int)
+	}
+}
+
+// coverageIndex locates the items of a FileCoverage by location so that
+// identical statements, functions and branches are merged instead of
+// duplicated, as istanbul-lib-coverage does
+type coverageIndex struct {
+	fc         *FileCoverage
+	statements map[string]string // item key -> ID
+	functions  map[string]string
+	branches   map[string]string
+
+	// Next free numeric IDs
+	nextStatement int
+	nextFunction  int
+	nextBranch    int
+}
+
+// newCoverageIndex indexes the existing items of fc
+func newCoverageIndex(fc *FileCoverage) *coverageIndex {
+	idx := &coverageIndex{
+		fc:         fc,
+		statements: make(map[string]string, len(fc.StatementMap)),
+		functions:  make(map[string]string, len(fc.FnMap)),
+		branches:   make(map[string]string, len(fc.BranchMap)),
+	}
+
+	for id, loc := range fc.StatementMap {
+		idx.statements[locationKey(loc)] = id
+		idx.nextStatement = nextIDAfter(id, idx.nextStatement)
+	}
+	for id, fn := range fc.FnMap {
+		idx.functions[functionKey(fn)] = id
+		idx.nextFunction = nextIDAfter(id, idx.nextFunction)
+	}
+	for id, branch := range fc.BranchMap {
+		idx.branches[branchKey(branch)] = id
+		idx.nextBranch = nextIDAfter(id, idx.nextBranch)
+	}
+
+	return idx
+}
+
+// nextIDAfter returns the next free ID given an existing ID and the current
+// next free ID. Non-numeric IDs are ignored.
+func nextIDAfter(id string, next int) int {
+	if n, err := strconv.Atoi(id); err == nil && n >= next {
+		return n + 1
+	}
+	return next
+}
+
+// addStatement adds hits to the statement at loc, creating it if needed
+func (idx *coverageIndex) addStatement(loc Location, hits int) {
+	key := locationKey(loc)
+	id, exists := idx.statements[key]
+	if !exists {
+		id = strconv.Itoa(idx.nextStatement)
+		idx.nextStatement++
+		idx.statements[key] = id
+		idx.fc.StatementMap[id] = loc
+	}
+	idx.fc.S[id] += hits
+}
+
+// addFunction adds hits to the function fn, creating it if needed
+func (idx *coverageIndex) addFunction(fn FunctionMeta, hits int) {
+	key := functionKey(fn)
+	id, exists := idx.functions[key]
+	if !exists {
+		id = strconv.Itoa(idx.nextFunction)
+		idx.nextFunction++
+		idx.functions[key] = id
+		idx.fc.FnMap[id] = fn
+	}
+	idx.fc.F[id] += hits
+}
+
+// addBranch adds hits element-wise to the branch, creating it if needed
+func (idx *coverageIndex) addBranch(branch BranchMeta, hits []int) {
+	key := branchKey(branch)
+	id, exists := idx.branches[key]
+	if !exists {
+		id = strconv.Itoa(idx.nextBranch)
+		idx.nextBranch++
+		idx.branches[key] = id
+		idx.fc.BranchMap[id] = branch
+	}
+	idx.fc.B[id] = addBranchHits(idx.fc.B[id], hits, len(branch.Locations))
+}
+
+// merge adds all items and hits of source
+func (idx *coverageIndex) merge(source *FileCoverage) {
+	for _, id := range sortedIDs(source.StatementMap) {
+		idx.addStatement(source.StatementMap[id], source.S[id])
+	}
+	for _, id := range sortedIDs(source.FnMap) {
+		idx.addFunction(source.FnMap[id], source.F[id])
+	}
+	for _, id := range sortedIDs(source.BranchMap) {
+		idx.addBranch(source.BranchMap[id], source.B[id])
+	}
+}
+
+// addBranchHits sums branch hit arrays element-wise into a new slice of size
+// elements, one per branch location. Hits past the last location are ignored.
+func addBranchHits(existing, hits []int, size int) []int {
+	result := make([]int, size)
+	copy(result, existing)
+	for i, h := range hits {
+		if i < size {
+			result[i] += h
+		}
+	}
+	return result
+}
+
+// locationKey identifies a location
+func locationKey(loc Location) string {
+	return fmt.Sprintf("%d:%d:%d:%d", loc.Start.Line, loc.Start.Column, loc.End.Line, loc.End.Column)
+}
+
+// functionKey identifies a function by name, declaration and body location
+func functionKey(fn FunctionMeta) string {
+	return fn.Name + "|" + locationKey(fn.Decl) + "|" + locationKey(fn.Loc)
+}
+
+// branchKey identifies a branch by type, location and branch locations
+func branchKey(branch BranchMeta) string {
+	var b strings.Builder
+	b.WriteString(branch.Type)
+	b.WriteString("|")
+	b.WriteString(locationKey(branch.Loc))
+	for _, loc := range branch.Locations {
+		b.WriteString("|")
+		b.WriteString(locationKey(loc))
+	}
+	return b.String()
+}
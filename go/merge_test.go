@@ -0,0 +1,205 @@
+package istanbul
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformMergesIdenticalItemsAcrossBundles(t *testing.T) {
+	chunk := func(name string, s, f int, b [2]int) string {
+		return `"dist/` + name + `.js": {
+			"path": "dist/` + name + `.js",
+			"statementMap": {"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 8}}},
+			"fnMap": {"0": {
+				"name": "util",
+				"decl": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 8}},
+				"loc": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 16}}
+			}},
+			"branchMap": {"0": {
+				"type": "if",
+				"loc": {"start": {"line": 1, "column": 8}, "end": {"line": 1, "column": 16}},
+				"locations": [
+					{"start": {"line": 1, "column": 8}, "end": {"line": 1, "column": 16}},
+					{"start": {"line": 1, "column": 8}, "end": {"line": 1, "column": 16}}
+				]
+			}},
+			"s": {"0": ` + strconv.Itoa(s) + `},
+			"f": {"0": ` + strconv.Itoa(f) + `},
+			"b": {"0": [` + strconv.Itoa(b[0]) + `, ` + strconv.Itoa(b[1]) + `]},
+			"inputSourceMap": {
+				"version": 3,
+				"sources": ["../src/util.ts"],
+				"names": [],
+				"mappings": "AAAA,QACA,QAAQ"
+			}
+		}`
+	}
+
+	coverageData := `{` + chunk("main", 2, 1, [2]int{1, 0}) + `,` + chunk("lazy", 3, 2, [2]int{0, 4}) + `}`
+	coverage, err := ParseCoverageMap([]byte(coverageData))
+	require.NoError(t, err)
+
+	result, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+
+	util := result[filepath.Join("src", "util.ts")]
+	require.NotNil(t, util)
+
+	require.Len(t, util.StatementMap, 1)
+	for id := range util.StatementMap {
+		assert.Equal(t, 5, util.S[id])
+	}
+
+	require.Len(t, util.FnMap, 1)
+	for id := range util.FnMap {
+		assert.Equal(t, 3, util.F[id])
+	}
+
+	require.Len(t, util.BranchMap, 1)
+	for id := range util.BranchMap {
+		assert.Equal(t, []int{1, 4}, util.B[id])
+	}
+}
+
+func TestFileCoverageMergeKeepsDistinctItems(t *testing.T) {
+	loc := func(line int) Location {
+		return Location{Start: Position{Line: line, Column: 0}, End: Position{Line: line, Column: 10}}
+	}
+
+	target := &FileCoverage{
+		Path:         "src/a.ts",
+		StatementMap: map[string]Location{"1": loc(1)},
+		FnMap:        map[string]FunctionMeta{"1": {Name: "a", Decl: loc(1), Loc: loc(1)}},
+		BranchMap:    map[string]BranchMeta{"1": {Type: "if", Loc: loc(2), Locations: []Location{loc(2), loc(3)}}},
+		S:            map[string]int{"1": 1},
+		F:            map[string]int{"1": 1},
+		B:            map[string][]int{"1": {1, 0}},
+	}
+	source := &FileCoverage{
+		Path:         "src/a.ts",
+		StatementMap: map[string]Location{"1": loc(1), "2": loc(2)},
+		FnMap:        map[string]FunctionMeta{"1": {Name: "b", Decl: loc(1), Loc: loc(1)}},
+		BranchMap:    map[string]BranchMeta{"1": {Type: "cond-expr", Loc: loc(2), Locations: []Location{loc(2), loc(3)}}},
+		S:            map[string]int{"1": 2, "2": 0},
+		F:            map[string]int{"1": 0},
+		B:            map[string][]int{"1": {0, 1}},
+	}
+
+	target.Merge(source)
+
+	assert.Len(t, target.StatementMap, 2)
+	assert.Equal(t, 3, target.S["1"])
+	assert.Len(t, target.FnMap, 2, "functions with different names are distinct")
+	assert.Len(t, target.BranchMap, 2, "branches with different types are distinct")
+	assert.Equal(t, []int{1, 0}, target.B["1"])
+
+	// The source branch hits are not aliased
+	source.B["1"][0] = 100
+	for id, branch := range target.BranchMap {
+		if branch.Type == "cond-expr" {
+			assert.Equal(t, []int{0, 1}, target.B[id])
+		}
+	}
+}
+
+func TestAddBranchHits(t *testing.T) {
+	assert.Equal(t, []int{1, 2}, addBranchHits(nil, []int{1, 2}, 2))
+	assert.Equal(t, []int{2, 2}, addBranchHits([]int{1, 2}, []int{1, 0, 3}, 2))
+	assert.Equal(t, []int{1, 0, 0}, addBranchHits([]int{1}, nil, 3))
+}
+
+func TestCoverageMapMerge(t *testing.T) {
+	shard1 := []byte(`{
+		"src/a.js": {
+			"path": "src/a.js",
+			"statementMap": {"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 10}}},
+			"fnMap": {}, "branchMap": {}, "s": {"0": 1}, "f": {}, "b": {}
+		}
+	}`)
+	shard2 := []byte(`{
+		"src/a.js": {
+			"path": "src/a.js",
+			"statementMap": {
+				"0": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 10}},
+				"1": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 10}}
+			},
+			"fnMap": {}, "branchMap": {}, "s": {"0": 0, "1": 4}, "f": {}, "b": {}
+		},
+		"src/b.js": {
+			"path": "src/b.js",
+			"statementMap": {"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 10}}},
+			"fnMap": {}, "branchMap": {}, "s": {"0": 2}, "f": {}, "b": {}
+		}
+	}`)
+
+	cm1, err := ParseCoverageMap(shard1)
+	require.NoError(t, err)
+	cm2, err := ParseCoverageMap(shard2)
+	require.NoError(t, err)
+
+	merged := MergeCoverageMaps(cm1, cm2)
+	require.Len(t, merged, 2)
+
+	a := merged["src/a.js"]
+	require.Len(t, a.StatementMap, 2)
+	for id, loc := range a.StatementMap {
+		if loc.Start.Line == 1 {
+			assert.Equal(t, 5, a.S[id])
+		} else {
+			assert.Equal(t, 0, a.S[id])
+		}
+	}
+	assert.Equal(t, 2, merged["src/b.js"].S["0"])
+
+	// The inputs are not modified
+	assert.Len(t, cm1["src/a.js"].StatementMap, 1)
+	assert.Equal(t, 1, cm1["src/a.js"].S["0"])
+
+	// Merging the JSON documents gives the same result
+	data, err := MergeCoverageBytes(shard1, shard2)
+	require.NoError(t, err)
+	fromBytes, err := ParseCoverageMap(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(merged), len(fromBytes))
+
+	_, err = MergeCoverageBytes(shard1, []byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestFileCoverageMergeAdoptsMissingHashes(t *testing.T) {
+	fc := &FileCoverage{Path: "a.js", Hash: "mine"}
+	fc.Merge(&FileCoverage{Path: "a.js", Hash: "theirs", CoverageSchema: "schema", ContentHash: "content"})
+
+	assert.Equal(t, "mine", fc.Hash)
+	assert.Equal(t, "schema", fc.CoverageSchema)
+	assert.Equal(t, "content", fc.ContentHash)
+}
+
+func TestTransformKeepsBranchHitsWithTheirLocations(t *testing.T) {
+	line := func(n int) Location {
+		return Location{Start: Position{Line: n}, End: Position{Line: n, Column: 5}}
+	}
+	fc := &FileCoverage{
+		Path: "dist/app.js",
+		BranchMap: map[string]BranchMeta{
+			"0": {Type: "if", Loc: line(1), Locations: []Location{line(3), line(1)}}, // line 3 is unmapped
+		},
+		B:              map[string][]int{"0": {7, 0}},
+		InputSourceMap: reportCoverage()["dist/app.js"].InputSourceMap,
+	}
+
+	result, err := NewCoverageTransformer().Transform(CoverageMap{fc.Path: fc})
+	require.NoError(t, err)
+	a := result["src/a.ts"]
+	require.NotNil(t, a)
+	assert.Len(t, a.BranchMap["0"].Locations, 1)
+	assert.Equal(t, []int{0}, a.B["0"])
+
+	data, err := result.ToJSON()
+	require.NoError(t, err)
+	assert.NoError(t, ValidateCoverageData(data))
+}
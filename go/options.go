@@ -0,0 +1,102 @@
+package istanbul
+
+import "runtime"
+
+// TransformOptions configures how coverage is transformed
+type TransformOptions struct {
+	// PathRewrites are applied in order to every output path
+	PathRewrites []PathRewrite
+	// ProjectRoot, if set, makes output paths under it relative to it
+	ProjectRoot string
+	// Include and Exclude are glob patterns matched against the output path
+	// of original sources; sources not included or excluded are dropped
+	Include []string
+	Exclude []string
+	// HonorIgnoreList drops sources listed in the source map ignoreList
+	// (or x_google_ignoreList)
+	HonorIgnoreList bool
+	// Workers is the number of files transformed concurrently
+	Workers int
+	// Strict fails the transform with a *MappingError instead of dropping
+	// unmappable or inconsistent items
+	Strict bool
+	// Cache holds parsed source maps; a new cache of DefaultCacheSize bytes
+	// is used if nil
+	Cache *ConsumerCache
+}
+
+// Option configures a CoverageTransformer
+type Option func(*TransformOptions)
+
+// WithPathRewrites appends rewrite rules applied to the CoverageMap keys and
+// FileCoverage paths of the transformed coverage
+func WithPathRewrites(rules ...PathRewrite) Option {
+	return func(o *TransformOptions) {
+		o.PathRewrites = append(o.PathRewrites, rules...)
+	}
+}
+
+// WithProjectRoot makes transformed paths relative to root
+func WithProjectRoot(root string) Option {
+	return func(o *TransformOptions) {
+		o.ProjectRoot = root
+	}
+}
+
+// WithInclude only keeps original sources matching one of the glob patterns
+func WithInclude(patterns ...string) Option {
+	return func(o *TransformOptions) {
+		o.Include = append(o.Include, patterns...)
+	}
+}
+
+// WithExclude drops original sources matching any of the glob patterns
+func WithExclude(patterns ...string) Option {
+	return func(o *TransformOptions) {
+		o.Exclude = append(o.Exclude, patterns...)
+	}
+}
+
+// WithIgnoreList drops original sources listed in the source map ignoreList
+func WithIgnoreList() Option {
+	return func(o *TransformOptions) {
+		o.HonorIgnoreList = true
+	}
+}
+
+// WithWorkers transforms up to n files concurrently. A value <= 0 uses one
+// worker per CPU.
+func WithWorkers(n int) Option {
+	return func(o *TransformOptions) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		o.Workers = n
+	}
+}
+
+// WithStrict makes the transform fail on locations that cannot be mapped,
+// missing hit counts, branch hit counts not matching the branch locations and
+// locations spanning several sources. Items removed by filters are not errors.
+func WithStrict() Option {
+	return func(o *TransformOptions) {
+		o.Strict = true
+	}
+}
+
+// WithCache uses cache for parsed source maps, so that it can be shared by
+// several transformers or bounded differently
+func WithCache(cache *ConsumerCache) Option {
+	return func(o *TransformOptions) {
+		o.Cache = cache
+	}
+}
+
+// newTransformOptions applies opts over the default options
+func newTransformOptions(opts []Option) TransformOptions {
+	options := TransformOptions{Workers: 1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
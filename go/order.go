@@ -0,0 +1,154 @@
+package istanbul
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// idMap is a map keyed by coverage IDs that encodes to JSON with numeric IDs
+// in numeric order ("2" before "10") rather than lexicographic order
+type idMap[V any] map[string]V
+
+// MarshalJSON encodes the map with its keys in ID order
+func (m idMap[V]) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, id := range sortedIDs(m) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(id)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m[id])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// sortedIDs returns the keys of m in ID order
+func sortedIDs[V any](m map[string]V) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return compareIDs(ids[i], ids[j]) < 0
+	})
+	return ids
+}
+
+// sortedPaths returns the file paths of a CoverageMap in lexicographic order
+func sortedPaths(cm CoverageMap) []string {
+	paths := make([]string, 0, len(cm))
+	for p := range cm {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// compareIDs orders numeric IDs numerically, before any non-numeric IDs
+// which are ordered lexicographically
+func compareIDs(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return na - nb
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePositions orders two positions
+func comparePositions(a, b Position) int {
+	if a.Line != b.Line {
+		return a.Line - b.Line
+	}
+	return a.Column - b.Column
+}
+
+// compareLocations orders two locations by start, then end
+func compareLocations(a, b Location) int {
+	if c := comparePositions(a.Start, b.Start); c != 0 {
+		return c
+	}
+	return comparePositions(a.End, b.End)
+}
+
+// renumber reassigns statement, function and branch IDs from 0 in order of
+// their original location, so that equal coverage always gets equal IDs
+func (fc *FileCoverage) renumber() {
+	stmtIDs := sortedIDs(fc.StatementMap)
+	sort.SliceStable(stmtIDs, func(i, j int) bool {
+		return compareLocations(fc.StatementMap[stmtIDs[i]], fc.StatementMap[stmtIDs[j]]) < 0
+	})
+	statementMap := make(map[string]Location, len(stmtIDs))
+	s := make(map[string]int, len(stmtIDs))
+	for i, id := range stmtIDs {
+		newID := strconv.Itoa(i)
+		statementMap[newID] = fc.StatementMap[id]
+		s[newID] = fc.S[id]
+	}
+	fc.StatementMap, fc.S = statementMap, s
+
+	fnIDs := sortedIDs(fc.FnMap)
+	sort.SliceStable(fnIDs, func(i, j int) bool {
+		a, b := fc.FnMap[fnIDs[i]], fc.FnMap[fnIDs[j]]
+		if c := compareLocations(a.Decl, b.Decl); c != 0 {
+			return c < 0
+		}
+		if c := compareLocations(a.Loc, b.Loc); c != 0 {
+			return c < 0
+		}
+		return a.Name < b.Name
+	})
+	fnMap := make(map[string]FunctionMeta, len(fnIDs))
+	f := make(map[string]int, len(fnIDs))
+	for i, id := range fnIDs {
+		newID := strconv.Itoa(i)
+		fnMap[newID] = fc.FnMap[id]
+		f[newID] = fc.F[id]
+	}
+	fc.FnMap, fc.F = fnMap, f
+
+	branchIDs := sortedIDs(fc.BranchMap)
+	sort.SliceStable(branchIDs, func(i, j int) bool {
+		a, b := fc.BranchMap[branchIDs[i]], fc.BranchMap[branchIDs[j]]
+		if c := compareLocations(a.Loc, b.Loc); c != 0 {
+			return c < 0
+		}
+		return branchKey(a) < branchKey(b)
+	})
+	branchMap := make(map[string]BranchMeta, len(branchIDs))
+	b := make(map[string][]int, len(branchIDs))
+	for i, id := range branchIDs {
+		newID := strconv.Itoa(i)
+		branchMap[newID] = fc.BranchMap[id]
+		if hits, exists := fc.B[id]; exists {
+			b[newID] = hits
+		}
+	}
+	fc.BranchMap, fc.B = branchMap, b
+}
@@ -0,0 +1,101 @@
+package istanbul
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformIsDeterministic(t *testing.T) {
+	coverage := largeBundleCoverage(200)
+
+	first, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+	firstJSON, err := first.ToJSON()
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		again, err := NewCoverageTransformer().Transform(coverage)
+		require.NoError(t, err)
+		againJSON, err := again.ToJSON()
+		require.NoError(t, err)
+		assert.Equal(t, string(firstJSON), string(againJSON))
+	}
+}
+
+func TestTransformAssignsIDsInOriginalOrder(t *testing.T) {
+	// Generated lines 1..3 map to original lines 3, 1 and 2
+	coverageData := `{
+		"dist/bundle.js": {
+			"path": "dist/bundle.js",
+			"statementMap": {
+				"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 5}},
+				"1": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 5}},
+				"2": {"start": {"line": 3, "column": 0}, "end": {"line": 3, "column": 5}}
+			},
+			"fnMap": {},
+			"branchMap": {},
+			"s": {"0": 30, "1": 10, "2": 20},
+			"f": {},
+			"b": {},
+			"inputSourceMap": {
+				"version": 3,
+				"sources": ["../src/a.ts"],
+				"names": [],
+				"mappings": "AAEA;AAFA;AACA"
+			}
+		}
+	}`
+
+	coverage, err := ParseCoverageMap([]byte(coverageData))
+	require.NoError(t, err)
+	result, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+
+	a := result[filepath.Join("src", "a.ts")]
+	require.NotNil(t, a)
+	assert.Equal(t, 1, a.StatementMap["0"].Start.Line)
+	assert.Equal(t, 2, a.StatementMap["1"].Start.Line)
+	assert.Equal(t, 3, a.StatementMap["2"].Start.Line)
+	assert.Equal(t, map[string]int{"0": 10, "1": 20, "2": 30}, a.S)
+}
+
+func TestToJSONOrdersIDsNumerically(t *testing.T) {
+	fc := &FileCoverage{
+		Path:         "src/a.js",
+		StatementMap: map[string]Location{},
+		FnMap:        map[string]FunctionMeta{},
+		BranchMap:    map[string]BranchMeta{},
+		S:            map[string]int{},
+		F:            map[string]int{},
+		B:            map[string][]int{},
+	}
+	for _, id := range []string{"10", "2", "1", "0"} {
+		fc.StatementMap[id] = Location{}
+		fc.S[id] = 1
+	}
+
+	data, err := CoverageMap{"src/a.js": fc}.ToJSON()
+	require.NoError(t, err)
+
+	out := string(data)
+	assert.Less(t, strings.Index(out, `"2": 1`), strings.Index(out, `"10": 1`))
+	assert.Less(t, strings.Index(out, `"1": 1`), strings.Index(out, `"2": 1`))
+
+	// Still decodes to the same coverage
+	var decoded CoverageMap
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, fc, decoded["src/a.js"])
+}
+
+func TestCompareIDs(t *testing.T) {
+	assert.Negative(t, compareIDs("2", "10"))
+	assert.Positive(t, compareIDs("10", "2"))
+	assert.Zero(t, compareIDs("3", "3"))
+	assert.Negative(t, compareIDs("99", "a"))
+	assert.Negative(t, compareIDs("a", "b"))
+}
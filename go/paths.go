@@ -0,0 +1,158 @@
+package istanbul
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ResolveSourcePath resolves a source map source to the path used as key in
+// the transformed CoverageMap. Bundler URLs (webpack://, ng://) are reduced
+// to project-relative paths, file:// URLs to local paths, and other relative
+// sources are resolved against the directory of the generated file, as
+// istanbul-lib-source-maps does.
+func ResolveSourcePath(source, generatedPath string) string {
+	p, projectRelative := stripSourceScheme(source)
+	if hasScheme(p) {
+		return p // Unknown URL scheme, keep as is
+	}
+
+	if path.IsAbs(p) || filepath.IsAbs(p) || projectRelative {
+		return filepath.Clean(filepath.FromSlash(p))
+	}
+
+	return filepath.Join(filepath.Dir(generatedPath), filepath.FromSlash(p))
+}
+
+// joinSourceRoot prefixes a source with the source map's sourceRoot
+func joinSourceRoot(sourceRoot, source string) string {
+	if sourceRoot == "" || isAbsoluteSource(source) {
+		return source
+	}
+	return strings.TrimSuffix(sourceRoot, "/") + "/" + source
+}
+
+// isAbsoluteSource reports whether source is an absolute path or URL
+func isAbsoluteSource(source string) bool {
+	return path.IsAbs(source) || filepath.IsAbs(source) || hasScheme(source)
+}
+
+// hasScheme reports whether s starts with a URL scheme such as "webpack://".
+// Single letters are rejected so Windows drive letters are not mistaken for
+// schemes.
+func hasScheme(s string) bool {
+	idx := strings.Index(s, "://")
+	if idx < 2 {
+		return false
+	}
+	for i, c := range s[:idx] {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// stripSourceScheme removes bundler and file URL schemes from a source.
+// projectRelative is true when the remaining relative path is relative to
+// the project (webpack context, Angular module) rather than the generated file.
+func stripSourceScheme(source string) (p string, projectRelative bool) {
+	lower := strings.ToLower(source)
+
+	switch {
+	case strings.HasPrefix(lower, "webpack://"):
+		// webpack://<namespace>/<path>?<loader query>
+		rest := source[len("webpack://"):]
+		if idx := strings.IndexByte(rest, '/'); idx >= 0 {
+			rest = rest[idx+1:]
+		}
+		if idx := strings.IndexByte(rest, '?'); idx >= 0 {
+			rest = rest[:idx]
+		}
+		return rest, true
+
+	case strings.HasPrefix(lower, "ng://"):
+		return source[len("ng://"):], true
+
+	case strings.HasPrefix(lower, "file://"):
+		u, err := url.Parse(source)
+		if err != nil {
+			return source[len("file://"):], false
+		}
+		p := u.Path
+		// file:///C:/dir/file.ts
+		if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+			p = p[1:]
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			p = "//" + u.Host + p
+		}
+		return p, false
+	}
+
+	return source, false
+}
+
+// PathRewrite rewrites output paths, either by prefix or by regular expression
+type PathRewrite struct {
+	Prefix      string         // replaced when the path starts with it
+	Pattern     *regexp.Regexp // replaced wherever it matches, if Prefix is empty
+	Replacement string
+}
+
+// PrefixRewrite creates a rule replacing a leading prefix of the path
+func PrefixRewrite(prefix, replacement string) PathRewrite {
+	return PathRewrite{Prefix: prefix, Replacement: replacement}
+}
+
+// RegexRewrite creates a rule replacing matches of pattern. The replacement
+// may reference capture groups as in regexp.Regexp.ReplaceAllString.
+func RegexRewrite(pattern, replacement string) (PathRewrite, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return PathRewrite{}, fmt.Errorf("invalid path rewrite pattern %q: %w", pattern, err)
+	}
+	return PathRewrite{Pattern: re, Replacement: replacement}, nil
+}
+
+// Apply rewrites p, returning it unchanged if the rule does not match
+func (r PathRewrite) Apply(p string) string {
+	if r.Prefix != "" {
+		if strings.HasPrefix(p, r.Prefix) {
+			return r.Replacement + p[len(r.Prefix):]
+		}
+		return p
+	}
+	if r.Pattern != nil {
+		return r.Pattern.ReplaceAllString(p, r.Replacement)
+	}
+	return p
+}
+
+// rewritePath applies the rewrite rules in order and then relativizes the
+// result against the project root
+func rewritePath(p string, opts *TransformOptions) string {
+	for _, rule := range opts.PathRewrites {
+		p = rule.Apply(p)
+	}
+	return relativeTo(opts.ProjectRoot, p)
+}
+
+// relativeTo makes an absolute path inside root relative to it. Other paths
+// are returned unchanged.
+func relativeTo(root, p string) string {
+	if root == "" || !filepath.IsAbs(p) {
+		return p
+	}
+	if rel, err := filepath.Rel(root, p); err == nil &&
+		rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return rel
+	}
+	return p
+}
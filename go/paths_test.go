@@ -0,0 +1,168 @@
+package istanbul
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSourcePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		generated string
+		expected  string
+	}{
+		{"relative to generated file", "../src/a.ts", "dist/bundle.js", filepath.Join("src", "a.ts")},
+		{"relative to absolute generated file", "../src/a.ts", "/app/dist/bundle.js", filepath.FromSlash("/app/src/a.ts")},
+		{"absolute source", "/app/src/a.ts", "dist/bundle.js", filepath.FromSlash("/app/src/a.ts")},
+		{"webpack without namespace", "webpack:///./src/a.ts", "dist/bundle.js", filepath.Join("src", "a.ts")},
+		{"webpack with namespace", "webpack://my-app/./src/a.ts", "dist/bundle.js", filepath.Join("src", "a.ts")},
+		{"webpack with loader query", "webpack:///./src/a.vue?5f3e", "dist/bundle.js", filepath.Join("src", "a.vue")},
+		{"webpack absolute", "webpack:////app/src/a.ts", "dist/bundle.js", filepath.FromSlash("/app/src/a.ts")},
+		{"angular", "ng://AppModule/app.component.html", "dist/main.js", filepath.Join("AppModule", "app.component.html")},
+		{"file url", "file:///app/src/a.ts", "dist/bundle.js", filepath.FromSlash("/app/src/a.ts")},
+		{"file url with escapes", "file:///app/src/my%20file.ts", "dist/bundle.js", filepath.FromSlash("/app/src/my file.ts")},
+		{"http url", "https://example.com/a.ts", "dist/bundle.js", "https://example.com/a.ts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ResolveSourcePath(tt.source, tt.generated))
+		})
+	}
+}
+
+func TestJoinSourceRoot(t *testing.T) {
+	assert.Equal(t, "src/a.ts", joinSourceRoot("", "src/a.ts"))
+	assert.Equal(t, "/app/src/a.ts", joinSourceRoot("/app/", "src/a.ts"))
+	assert.Equal(t, "webpack:///src/a.ts", joinSourceRoot("webpack:///", "src/a.ts"))
+	assert.Equal(t, "/abs/a.ts", joinSourceRoot("/app", "/abs/a.ts"))
+	assert.Equal(t, "webpack:///./a.ts", joinSourceRoot("/app", "webpack:///./a.ts"))
+}
+
+func TestTransformResolvesSourcePaths(t *testing.T) {
+	coverageData := `{
+		"/app/dist/bundle.js": {
+			"path": "/app/dist/bundle.js",
+			"statementMap": {
+				"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 10}},
+				"1": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 10}}
+			},
+			"fnMap": {},
+			"branchMap": {},
+			"s": {"0": 1, "1": 0},
+			"f": {},
+			"b": {},
+			"inputSourceMap": {
+				"version": 3,
+				"sourceRoot": "../",
+				"sources": ["src/a.ts", "webpack:///./src/b.ts"],
+				"names": [],
+				"mappings": "AAAA;ACAA"
+			}
+		}
+	}`
+
+	coverage, err := ParseCoverageMap([]byte(coverageData))
+	require.NoError(t, err)
+
+	result, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+
+	absPath := filepath.FromSlash("/app/src/a.ts")
+	require.Contains(t, result, absPath)
+	assert.Equal(t, absPath, result[absPath].Path)
+	assert.Contains(t, result, filepath.Join("src", "b.ts"))
+}
+
+func TestTransformWithPathRewrites(t *testing.T) {
+	coverageData := `{
+		"/home/ci1/ws/src/a.js": {
+			"path": "/home/ci1/ws/src/a.js",
+			"statementMap": {"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 10}}},
+			"fnMap": {}, "branchMap": {}, "s": {"0": 1}, "f": {}, "b": {}
+		},
+		"/builds/ci2/src/a.js": {
+			"path": "/builds/ci2/src/a.js",
+			"statementMap": {"0": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 10}}},
+			"fnMap": {}, "branchMap": {}, "s": {"0": 3}, "f": {}, "b": {}
+		}
+	}`
+
+	coverage, err := ParseCoverageMap([]byte(coverageData))
+	require.NoError(t, err)
+
+	builds, err := RegexRewrite(`^/builds/[^/]+/`, "")
+	require.NoError(t, err)
+
+	transformer := NewCoverageTransformer(WithPathRewrites(
+		PrefixRewrite("/home/ci1/ws/", ""),
+		builds,
+	))
+	result, err := transformer.Transform(coverage)
+	require.NoError(t, err)
+
+	require.Len(t, result, 1)
+	require.Contains(t, result, "src/a.js")
+	assert.Equal(t, "src/a.js", result["src/a.js"].Path)
+	assert.Len(t, result["src/a.js"].StatementMap, 2)
+
+	// The input coverage is left untouched
+	assert.Equal(t, "/builds/ci2/src/a.js", coverage["/builds/ci2/src/a.js"].Path)
+	assert.Len(t, coverage["/builds/ci2/src/a.js"].StatementMap, 1)
+	assert.Len(t, coverage["/home/ci1/ws/src/a.js"].StatementMap, 1)
+}
+
+func TestTransformWithProjectRoot(t *testing.T) {
+	root := t.TempDir()
+	inside := filepath.Join(root, "src", "a.js")
+	outside := filepath.Join(filepath.Dir(root), "other", "b.js")
+
+	coverage := CoverageMap{}
+	for _, p := range []string{inside, outside} {
+		coverage[p] = &FileCoverage{
+			Path:         p,
+			StatementMap: map[string]Location{},
+			FnMap:        map[string]FunctionMeta{},
+			BranchMap:    map[string]BranchMeta{},
+			S:            map[string]int{},
+			F:            map[string]int{},
+			B:            map[string][]int{},
+		}
+	}
+
+	result, err := NewCoverageTransformer(WithProjectRoot(root)).Transform(coverage)
+	require.NoError(t, err)
+
+	rel := filepath.Join("src", "a.js")
+	require.Contains(t, result, rel)
+	assert.Equal(t, rel, result[rel].Path)
+
+	// Paths outside the project root stay absolute
+	assert.Contains(t, result, outside)
+}
+
+func TestTransformWithProjectRootKeepsInputIDs(t *testing.T) {
+	line := func(n int) Location {
+		return Location{Start: Position{Line: n}, End: Position{Line: n, Column: 5}}
+	}
+	coverage := CoverageMap{
+		"/w/src/a.js": {
+			Path:         "/w/src/a.js",
+			StatementMap: map[string]Location{"2": line(1), "5": line(2)},
+			S:            map[string]int{"2": 1, "5": 0},
+		},
+	}
+
+	// Entries without a source map are only moved, not renumbered or hashed
+	result, err := NewCoverageTransformer(WithProjectRoot("/w")).Transform(coverage)
+	require.NoError(t, err)
+	fc := result[filepath.Join("src", "a.js")]
+	require.NotNil(t, fc)
+	assert.Equal(t, map[string]int{"2": 1, "5": 0}, fc.S)
+	assert.Empty(t, fc.CoverageSchema)
+	assert.Empty(t, fc.Hash)
+}
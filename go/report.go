@@ -0,0 +1,136 @@
+package istanbul
+
+import "sort"
+
+// DropReason explains why a statement, function or branch of a generated
+// file is missing from the transformed coverage
+type DropReason string
+
+const (
+	// DropNoMapping means the start of the item has no source map mapping.
+	// For a part of a mapped item, it means that part, such as the end of a
+	// location, has none.
+	DropNoMapping DropReason = "no-mapping"
+	// DropCrossSource means parts of the item map to different original
+	// sources: the start and end of a location, a function body and its
+	// declaration, or a branch location and the branch. Outside strict mode
+	// a location is cut down to the mapping of its start instead.
+	DropCrossSource DropReason = "cross-source"
+	// DropMissingHits means the item has no hit count in s, f or b
+	DropMissingHits DropReason = "missing-hits"
+	// DropFiltered means the item maps to a source removed by the include,
+	// exclude or ignore list filters
+	DropFiltered DropReason = "filtered"
+	// DropHitCountMismatch means a branch has a different number of hit
+	// counts than locations. Such branches are only rejected in strict mode.
+	DropHitCountMismatch DropReason = "hit-count-mismatch"
+)
+
+// TransformReport describes how the coverage of each generated file with a
+// source map was mapped to original sources
+type TransformReport struct {
+	Files map[string]*FileReport `json:"files"` // keyed by generated file path
+}
+
+// FileReport counts the mapped and dropped items of one generated file
+type FileReport struct {
+	Path       string     `json:"path"`
+	Statements ItemReport `json:"statements"`
+	Functions  ItemReport `json:"functions"`
+	Branches   ItemReport `json:"branches"`
+	Sources    []string   `json:"sources"` // output paths produced, sorted
+}
+
+// ItemReport counts the items of one kind
+type ItemReport struct {
+	Total   int                `json:"total"`
+	Mapped  int                `json:"mapped"`
+	Dropped map[DropReason]int `json:"dropped,omitempty"`
+	// Partial counts, by reason, the parts of mapped items that were left
+	// out: location ends cut down to the mapping of their start, branch
+	// locations that could not be mapped, and function bodies replaced by
+	// the function declaration
+	Partial map[DropReason]int `json:"partial,omitempty"`
+}
+
+// DroppedCount returns the number of dropped items for all reasons
+func (r ItemReport) DroppedCount() int {
+	n := 0
+	for _, count := range r.Dropped {
+		n += count
+	}
+	return n
+}
+
+// PartialCount returns the number of parts left out of mapped items for all
+// reasons
+func (r ItemReport) PartialCount() int {
+	n := 0
+	for _, count := range r.Partial {
+		n += count
+	}
+	return n
+}
+
+// MappedRatio returns the fraction of items that were mapped, or 1 if there
+// are none
+func (r ItemReport) MappedRatio() float64 {
+	if r.Total == 0 {
+		return 1
+	}
+	return float64(r.Mapped) / float64(r.Total)
+}
+
+// drop records an item dropped for reason
+func (r *ItemReport) drop(reason DropReason) {
+	if r.Dropped == nil {
+		r.Dropped = make(map[DropReason]int)
+	}
+	r.Dropped[reason]++
+}
+
+// partial records a part of a mapped item left out for reason
+func (r *ItemReport) partial(reason DropReason) {
+	if r.Partial == nil {
+		r.Partial = make(map[DropReason]int)
+	}
+	r.Partial[reason]++
+}
+
+// add adds the counts of other
+func (r *ItemReport) add(other ItemReport) {
+	r.Total += other.Total
+	r.Mapped += other.Mapped
+	for reason, count := range other.Dropped {
+		if r.Dropped == nil {
+			r.Dropped = make(map[DropReason]int)
+		}
+		r.Dropped[reason] += count
+	}
+	for reason, count := range other.Partial {
+		if r.Partial == nil {
+			r.Partial = make(map[DropReason]int)
+		}
+		r.Partial[reason] += count
+	}
+}
+
+// Totals sums the reports of all files. The Path of the result is empty and
+// its Sources lists every source produced.
+func (r *TransformReport) Totals() FileReport {
+	var total FileReport
+	seen := make(map[string]bool)
+	for _, fr := range r.Files {
+		total.Statements.add(fr.Statements)
+		total.Functions.add(fr.Functions)
+		total.Branches.add(fr.Branches)
+		for _, source := range fr.Sources {
+			if !seen[source] {
+				seen[source] = true
+				total.Sources = append(total.Sources, source)
+			}
+		}
+	}
+	sort.Strings(total.Sources)
+	return total
+}
@@ -0,0 +1,293 @@
+package istanbul
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reportCoverage maps line 1 to src/a.ts, line 2 to vendor/b.js and leaves
+// line 3 unmapped
+func reportCoverage() CoverageMap {
+	line := func(n int) Location {
+		return Location{Start: Position{Line: n, Column: 0}, End: Position{Line: n, Column: 5}}
+	}
+
+	fc := &FileCoverage{
+		Path: "dist/app.js",
+		StatementMap: map[string]Location{
+			"0": line(1), // mapped
+			"1": line(2), // filtered
+			"2": line(3), // no mapping
+			"3": line(1), // missing hits
+		},
+		S: map[string]int{"0": 1, "1": 1, "2": 1},
+		FnMap: map[string]FunctionMeta{
+			"0": {Name: "a", Decl: line(1), Loc: line(1)}, // mapped
+			"1": {Name: "b", Decl: line(3), Loc: line(3)}, // no mapping
+		},
+		F: map[string]int{"0": 1, "1": 0},
+		BranchMap: map[string]BranchMeta{
+			"0": {Type: "if", Loc: line(1), Locations: []Location{line(2)}}, // cross-source
+			"1": {Type: "if", Loc: line(1), Locations: []Location{line(1)}}, // mapped
+			"2": {Type: "if", Loc: line(1), Locations: []Location{line(1)}}, // missing hits
+		},
+		B: map[string][]int{"0": {1}, "1": {1}},
+		InputSourceMap: &SourceMap{
+			Version:  3,
+			Sources:  []string{"../src/a.ts", "../vendor/b.js"},
+			Names:    []string{},
+			Mappings: "AAAA;ACAA",
+		},
+	}
+
+	return CoverageMap{
+		fc.Path:    fc,
+		"plain.js": {Path: "plain.js"},
+	}
+}
+
+func TestTransformWithReport(t *testing.T) {
+	ct := NewCoverageTransformer(WithExclude("vendor/**"))
+	result, report, err := ct.TransformWithReport(context.Background(), reportCoverage())
+	require.NoError(t, err)
+	assert.Contains(t, result, "src/a.ts")
+	assert.NotContains(t, result, "vendor/b.js")
+
+	// Only generated files with a source map are reported
+	require.Len(t, report.Files, 1)
+	fr := report.Files["dist/app.js"]
+	require.NotNil(t, fr)
+
+	assert.Equal(t, "dist/app.js", fr.Path)
+	assert.Equal(t, ItemReport{
+		Total:  4,
+		Mapped: 1,
+		Dropped: map[DropReason]int{
+			DropFiltered:    1,
+			DropNoMapping:   1,
+			DropMissingHits: 1,
+		},
+	}, fr.Statements)
+	assert.Equal(t, ItemReport{
+		Total:   2,
+		Mapped:  1,
+		Dropped: map[DropReason]int{DropNoMapping: 1},
+	}, fr.Functions)
+	assert.Equal(t, ItemReport{
+		Total:  3,
+		Mapped: 1,
+		Dropped: map[DropReason]int{
+			DropCrossSource: 1,
+			DropMissingHits: 1,
+		},
+	}, fr.Branches)
+	assert.Equal(t, []string{"src/a.ts"}, fr.Sources)
+
+	assert.Equal(t, 3, fr.Statements.DroppedCount())
+	assert.Equal(t, 0.25, fr.Statements.MappedRatio())
+	assert.Equal(t, 1.0, ItemReport{}.MappedRatio())
+
+	totals := report.Totals()
+	assert.Equal(t, "", totals.Path)
+	assert.Equal(t, fr.Statements, totals.Statements)
+	assert.Equal(t, fr.Sources, totals.Sources)
+}
+
+func TestTransformCoverageWithReport(t *testing.T) {
+	data, err := json.Marshal(reportCoverage())
+	require.NoError(t, err)
+
+	ist := New(WithProjectRoot("/project"), WithPathRewrites(PrefixRewrite("src/", "/project/lib/")))
+	result, report, err := ist.TransformCoverageWithReport(context.Background(), data)
+	require.NoError(t, err)
+
+	// Sources are reported with their output paths
+	fr := report.Files["dist/app.js"]
+	require.NotNil(t, fr)
+	assert.Equal(t, []string{"lib/a.ts", "vendor/b.js"}, fr.Sources)
+	assert.Equal(t, 2, fr.Statements.Mapped)
+
+	var coverage CoverageMap
+	require.NoError(t, json.Unmarshal(result, &coverage))
+	assert.Contains(t, coverage, "lib/a.ts")
+
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"dropped":{"missing-hits":1,"no-mapping":1}`)
+}
+
+func TestStrictModeFailsOnFirstBadItem(t *testing.T) {
+	_, err := NewCoverageTransformer(WithStrict(), WithExclude("vendor/**")).Transform(reportCoverage())
+	require.Error(t, err)
+
+	// Statement 1 is filtered, which is not an error
+	var mappingErr *MappingError
+	require.ErrorAs(t, err, &mappingErr)
+	assert.Equal(t, "dist/app.js", mappingErr.File)
+	assert.Equal(t, "statement", mappingErr.Kind)
+	assert.Equal(t, "2", mappingErr.ID)
+	assert.Equal(t, DropNoMapping, mappingErr.Reason)
+	assert.Contains(t, err.Error(), "statement 2 of dist/app.js: no-mapping")
+}
+
+func TestStrictModeErrors(t *testing.T) {
+	line := func(n int) Location {
+		return Location{Start: Position{Line: n, Column: 0}, End: Position{Line: n, Column: 5}}
+	}
+	sm := reportCoverage()["dist/app.js"].InputSourceMap
+
+	tests := []struct {
+		name   string
+		fc     *FileCoverage
+		kind   string
+		reason DropReason
+	}{
+		{
+			name: "missing statement hits",
+			fc: &FileCoverage{
+				StatementMap: map[string]Location{"0": line(1)},
+			},
+			kind:   "statement",
+			reason: DropMissingHits,
+		},
+		{
+			name: "statement spanning sources",
+			fc: &FileCoverage{
+				StatementMap: map[string]Location{"0": {Start: Position{Line: 1}, End: Position{Line: 2, Column: 5}}},
+				S:            map[string]int{"0": 1},
+			},
+			kind:   "statement",
+			reason: DropCrossSource,
+		},
+		{
+			name: "statement ending on an unmapped line",
+			fc: &FileCoverage{
+				StatementMap: map[string]Location{"0": {Start: Position{Line: 1}, End: Position{Line: 3, Column: 5}}},
+				S:            map[string]int{"0": 1},
+			},
+			kind:   "statement",
+			reason: DropNoMapping,
+		},
+		{
+			name: "function body in another source",
+			fc: &FileCoverage{
+				FnMap: map[string]FunctionMeta{"0": {Name: "f", Decl: line(1), Loc: line(2)}},
+				F:     map[string]int{"0": 1},
+			},
+			kind:   "function",
+			reason: DropCrossSource,
+		},
+		{
+			name: "branch hit count mismatch",
+			fc: &FileCoverage{
+				BranchMap: map[string]BranchMeta{"0": {Type: "if", Loc: line(1), Locations: []Location{line(1)}}},
+				B:         map[string][]int{"0": {1, 0}},
+			},
+			kind:   "branch",
+			reason: DropHitCountMismatch,
+		},
+		{
+			name: "unmappable branch location",
+			fc: &FileCoverage{
+				BranchMap: map[string]BranchMeta{"0": {Type: "if", Loc: line(1), Locations: []Location{line(1), line(3)}}},
+				B:         map[string][]int{"0": {1, 0}},
+			},
+			kind:   "branch",
+			reason: DropNoMapping,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fc.Path = "dist/app.js"
+			tt.fc.InputSourceMap = sm
+			coverage := CoverageMap{tt.fc.Path: tt.fc}
+
+			// Without strict mode the item is dropped or kept
+			_, err := NewCoverageTransformer().Transform(coverage)
+			require.NoError(t, err)
+
+			_, err = NewCoverageTransformer(WithStrict()).Transform(coverage)
+			var mappingErr *MappingError
+			require.ErrorAs(t, err, &mappingErr)
+			assert.Equal(t, tt.kind, mappingErr.Kind)
+			assert.Equal(t, "0", mappingErr.ID)
+			assert.Equal(t, tt.reason, mappingErr.Reason)
+		})
+	}
+}
+
+func TestStrictModeAcceptsConsistentCoverage(t *testing.T) {
+	want, err := NewCoverageTransformer().Transform(largeBundleCoverage(10))
+	require.NoError(t, err)
+	got, err := NewCoverageTransformer(WithStrict()).Transform(largeBundleCoverage(10))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestStrictModeAcceptsImplicitElse(t *testing.T) {
+	line := func(n int) Location {
+		return Location{Start: Position{Line: n, Column: 0}, End: Position{Line: n, Column: 5}}
+	}
+	fc := &FileCoverage{
+		Path:           "dist/app.js",
+		BranchMap:      map[string]BranchMeta{"0": {Type: "if", Loc: line(1), Locations: []Location{line(1), {}}}},
+		B:              map[string][]int{"0": {3, 0}},
+		InputSourceMap: reportCoverage()["dist/app.js"].InputSourceMap,
+	}
+
+	// The implicit else is kept, empty, with its hits
+	result, report, err := NewCoverageTransformer(WithStrict()).TransformWithReport(context.Background(), CoverageMap{fc.Path: fc})
+	require.NoError(t, err)
+	a := result["src/a.ts"]
+	require.NotNil(t, a)
+	require.Len(t, a.BranchMap["0"].Locations, 2)
+	assert.Equal(t, Location{}, a.BranchMap["0"].Locations[1])
+	assert.Equal(t, []int{3, 0}, a.B["0"])
+	assert.Equal(t, 1, report.Files["dist/app.js"].Branches.Mapped)
+}
+
+func TestTransformReportsPartiallyMappedItems(t *testing.T) {
+	line := func(n int) Location {
+		return Location{Start: Position{Line: n, Column: 0}, End: Position{Line: n, Column: 5}}
+	}
+	fc := &FileCoverage{
+		Path: "dist/app.js",
+		StatementMap: map[string]Location{
+			"0": {Start: Position{Line: 1}, End: Position{Line: 2, Column: 5}}, // ends in another source
+			"1": {Start: Position{Line: 1}, End: Position{Line: 3, Column: 5}}, // ends unmapped
+		},
+		S:     map[string]int{"0": 1, "1": 1},
+		FnMap: map[string]FunctionMeta{"0": {Name: "f", Decl: line(1), Loc: line(3)}}, // body unmapped
+		F:     map[string]int{"0": 1},
+		BranchMap: map[string]BranchMeta{
+			"0": {Type: "switch", Loc: line(1), Locations: []Location{line(1), line(2), line(3)}},
+		},
+		B:              map[string][]int{"0": {1, 2, 3}},
+		InputSourceMap: reportCoverage()["dist/app.js"].InputSourceMap,
+	}
+
+	_, report, err := NewCoverageTransformer().TransformWithReport(context.Background(), CoverageMap{fc.Path: fc})
+	require.NoError(t, err)
+	fr := report.Files["dist/app.js"]
+	require.NotNil(t, fr)
+
+	// The items are mapped, with the parts left out reported
+	assert.Equal(t, ItemReport{
+		Total:   2,
+		Mapped:  2,
+		Partial: map[DropReason]int{DropCrossSource: 1, DropNoMapping: 1},
+	}, fr.Statements)
+	assert.Equal(t, ItemReport{Total: 1, Mapped: 1, Partial: map[DropReason]int{DropNoMapping: 1}}, fr.Functions)
+	assert.Equal(t, ItemReport{
+		Total:   1,
+		Mapped:  1,
+		Partial: map[DropReason]int{DropCrossSource: 1, DropNoMapping: 1},
+	}, fr.Branches)
+	assert.Equal(t, 2, fr.Branches.PartialCount())
+	assert.Equal(t, 2, report.Totals().Branches.PartialCount())
+}
@@ -1,123 +1,278 @@
 package istanbul
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+)
+
+// Bias controls which mapping segment a lookup picks when the generated
+// position falls between segments
+type Bias int
 
-	"github.com/go-sourcemap/sourcemap"
+const (
+	// GreatestLowerBound picks the closest segment at or before the position
+	GreatestLowerBound Bias = iota
+	// LeastUpperBound picks the closest segment at or after the position
+	LeastUpperBound
 )
 
-// SourceMapTransformer handles source map transformations
+// LookupOptions configures OriginalPositionFor
+type LookupOptions struct {
+	Bias Bias
+	// SearchForward falls back to the next mapped segment on the same
+	// generated line when the biased lookup finds nothing
+	SearchForward bool
+}
+
+// maxParsedMaps bounds the number of source maps remembered by pointer
+const maxParsedMaps = 64
+
+// SourceMapTransformer handles source map transformations. It is safe for
+// concurrent use.
 type SourceMapTransformer struct {
-	cache map[string]*sourcemap.Consumer
+	cache *ConsumerCache
+
+	// parsed remembers the consumer of recently used source maps so that
+	// repeated lookups skip hashing the map for the cache key. Only forks
+	// used while transforming one file, whose maps do not change, have it.
+	parsed map[*SourceMap]*sourceMapConsumer
 }
 
-// NewSourceMapTransformer creates a new transformer
+// NewSourceMapTransformer creates a new transformer with its own unbounded
+// cache of parsed source maps
 func NewSourceMapTransformer() *SourceMapTransformer {
+	return NewSourceMapTransformerWithCache(NewConsumerCache(0))
+}
+
+// NewSourceMapTransformerWithCache creates a new transformer using cache for
+// parsed source maps
+func NewSourceMapTransformerWithCache(cache *ConsumerCache) *SourceMapTransformer {
+	return &SourceMapTransformer{cache: cache}
+}
+
+// fork returns a transformer sharing the parsed source map cache but with
+// its own memo of recently used maps. The fork is not safe for concurrent use
+// and its maps must not be modified while it is used.
+func (smt *SourceMapTransformer) fork() *SourceMapTransformer {
 	return &SourceMapTransformer{
-		cache: make(map[string]*sourcemap.Consumer),
+		cache:  smt.cache,
+		parsed: make(map[*SourceMap]*sourceMapConsumer),
 	}
 }
 
 // GetOriginalPosition maps a generated position to original position
 func (smt *SourceMapTransformer) GetOriginalPosition(sm *SourceMap, pos Position) (*MappingResult, error) {
-	// Create cache key
-	cacheKey := fmt.Sprintf("%s:%s", sm.File, sm.Mappings)
-
-	// Check cache
-	consumer, exists := smt.cache[cacheKey]
-	if !exists {
-		// Parse source map
-		var err error
-		consumer, err = sourcemap.Parse(sm.File, []byte(sourceMapToJSON(sm)))
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse source map: %w", err)
-		}
-		smt.cache[cacheKey] = consumer
+	consumer, rel, err := smt.consumerFor(sm, pos)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get original position
-	file, _, line, col, ok := consumer.Source(pos.Line, pos.Column)
+	m, ok := consumer.originalPositionTryBoth(rel.Line, rel.Column)
 	if !ok {
-		return nil, fmt.Errorf("no mapping found for position %d:%d", pos.Line, pos.Column)
+		return nil, fmt.Errorf("%w for position %d:%d", ErrNoMapping, pos.Line, pos.Column)
 	}
 
-	return &MappingResult{
-		Source: file,
-		Location: Location{
-			Start: Position{Line: line, Column: col},
-			End:   Position{Line: line, Column: col}, // For now, assume single position
-		},
-	}, nil
+	return consumer.result(m), nil
+}
+
+// OriginalPositionFor maps a generated position to its original position
+// using the given lookup bias, like originalPositionFor in Mozilla's
+// source-map library
+func (smt *SourceMapTransformer) OriginalPositionFor(sm *SourceMap, pos Position, opts LookupOptions) (*MappingResult, error) {
+	consumer, rel, err := smt.consumerFor(sm, pos)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := consumer.originalPositionFor(rel.Line, rel.Column, opts.Bias)
+	if !ok && opts.SearchForward {
+		m, ok = consumer.searchForward(rel.Line, rel.Column)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w for position %d:%d", ErrNoMapping, pos.Line, pos.Column)
+	}
+
+	return consumer.result(m), nil
 }
 
-// MapLocation maps a generated location to original location
+// MapLocation maps a generated location to the original range it covers.
+// The end is derived from the mapping segments around the generated end,
+// following istanbul-lib-source-maps.
 func (smt *SourceMapTransformer) MapLocation(sm *SourceMap, loc Location) (*MappingResult, error) {
+	mapping, _, err := smt.mapLocation(sm, loc, false)
+	return mapping, err
+}
+
+// errCrossSource is returned by mapLocation in strict mode when the start and
+// end of a location map to different sources
+var errCrossSource = errors.New("start and end map to different sources")
+
+// mapLocation maps a generated location like MapLocation. A location whose
+// end cannot be mapped, or maps to another source than its start, falls back
+// to the start mapping and the reason is returned with it. In strict mode
+// such a location fails instead, with ErrNoMapping or errCrossSource.
+func (smt *SourceMapTransformer) mapLocation(
+	sm *SourceMap, loc Location, strict bool,
+) (*MappingResult, DropReason, error) {
 	// Map start position
 	startMapping, err := smt.GetOriginalPosition(sm, loc.Start)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	start := startMapping.Location.Start
 
 	// Map end position
-	endMapping, err := smt.GetOriginalPosition(sm, loc.End)
+	consumer, rel, err := smt.consumerFor(sm, loc.End)
 	if err != nil {
-		// If end mapping fails, use start mapping
-		endMapping = &MappingResult{
-			Source: startMapping.Source,
-			Location: Location{
-				Start: startMapping.Location.Start,
-				End:   startMapping.Location.Start,
-			},
+		if strict {
+			return nil, "", err
 		}
+		return startMapping, DropNoMapping, nil // Use start mapping if the end is not covered
 	}
+	endMapping, ok := consumer.originalEndPositionFor(rel.Line, rel.Column)
+	if !ok {
+		if strict {
+			return nil, "", fmt.Errorf("%w for end position %d:%d", ErrNoMapping, loc.End.Line, loc.End.Column)
+		}
+		return startMapping, DropNoMapping, nil // Use start mapping if the end is not mapped
+	}
+	if consumer.sources[endMapping.source] != startMapping.Source {
+		if strict {
+			return nil, "", errCrossSource
+		}
+		return startMapping, DropCrossSource, nil // Use start mapping if sources differ
+	}
+	end := Position{Line: endMapping.origLine, Column: endMapping.origColumn}
 
-	// Ensure both positions map to the same source
-	if startMapping.Source != endMapping.Source {
-		return startMapping, nil // Use start mapping if sources differ
+	// A zero-width range means the end fell on the start segment; extend it
+	// up to the segment following the generated end
+	if end == start {
+		next, ok := consumer.originalPositionFor(rel.Line, rel.Column, LeastUpperBound)
+		if ok && consumer.sources[next.source] == startMapping.Source &&
+			next.origLine == start.Line && next.origColumn-1 > start.Column {
+			end = Position{Line: next.origLine, Column: next.origColumn - 1}
+		}
+	}
+
+	if end.Line < start.Line || (end.Line == start.Line && end.Column < start.Column) {
+		return startMapping, "", nil // Inverted range, keep the start position
 	}
 
 	return &MappingResult{
 		Source: startMapping.Source,
 		Location: Location{
-			Start: startMapping.Location.Start,
-			End:   endMapping.Location.End,
+			Start: start,
+			End:   end,
 		},
-	}, nil
+	}, "", nil
+}
+
+// consumerFor returns the parsed flat source map covering pos, along with
+// pos translated into that map's generated coordinates
+func (smt *SourceMapTransformer) consumerFor(sm *SourceMap, pos Position) (*sourceMapConsumer, Position, error) {
+	// Resolve index maps down to the flat map covering this position
+	sm, pos, err := resolveSection(sm, pos)
+	if err != nil {
+		return nil, pos, err
+	}
+	consumer, err := smt.consumer(sm)
+	return consumer, pos, err
 }
 
-// sourceMapToJSON converts SourceMap struct to JSON string for parsing
-func sourceMapToJSON(sm *SourceMap) string {
-	// Create a minimal source map JSON
-	return fmt.Sprintf(`{
-		"version": %d,
-		"sources": %s,
-		"names": %s,
-		"mappings": "%s",
-		"file": "%s",
-		"sourceRoot": "%s"
-	}`,
-		sm.Version,
-		arrayToJSON(sm.Sources),
-		arrayToJSON(sm.Names),
-		sm.Mappings,
-		sm.File,
-		sm.SourceRoot,
-	)
+// consumer returns the parsed form of a flat source map
+func (smt *SourceMapTransformer) consumer(sm *SourceMap) (*sourceMapConsumer, error) {
+	consumer, exists := smt.parsed[sm]
+	if exists {
+		return consumer, nil
+	}
+
+	// Check cache
+	key := sourceMapKey(sm)
+	consumer, exists = smt.cache.get(key)
+	if !exists {
+		// Parse source map
+		var err error
+		consumer, err = newSourceMapConsumer(sm)
+		if err != nil {
+			return nil, &SourceMapError{Err: err}
+		}
+		smt.cache.put(key, consumer)
+	}
+
+	if smt.parsed != nil {
+		if len(smt.parsed) >= maxParsedMaps {
+			// Forget old maps so they can be garbage collected
+			clear(smt.parsed)
+		}
+		smt.parsed[sm] = consumer
+	}
+
+	return consumer, nil
 }
 
-// arrayToJSON converts string array to JSON array string
-func arrayToJSON(arr []string) string {
-	if len(arr) == 0 {
-		return "[]"
+// checkSourceMap parses a source map and the maps of all its sections,
+// returning the first error. Sections referenced by URL are not supported
+// and skipped; positions in them are simply not mapped.
+func (smt *SourceMapTransformer) checkSourceMap(sm *SourceMap) error {
+	if !sm.IsIndexed() {
+		_, err := smt.consumer(sm)
+		return err
+	}
+	for idx, section := range sm.Sections {
+		if section.Map == nil {
+			if section.URL != "" {
+				continue
+			}
+			return &SourceMapError{Err: fmt.Errorf("missing map in source map section %d", idx)}
+		}
+		if err := smt.checkSourceMap(section.Map); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// resolveSection walks the sections of an index map (including nested index
+// maps) and returns the flat source map covering pos together with pos
+// translated into that map's generated coordinates
+func resolveSection(sm *SourceMap, pos Position) (*SourceMap, Position, error) {
+	for sm.IsIndexed() {
+		// Sections are ordered and non-overlapping, so pick the last one
+		// starting at or before pos
+		idx := sort.Search(len(sm.Sections), func(i int) bool {
+			return sectionStartsAfter(sm.Sections[i].Offset, pos)
+		}) - 1
+		if idx < 0 {
+			return nil, pos, fmt.Errorf("%w for position %d:%d: no section", ErrNoMapping, pos.Line, pos.Column)
+		}
+
+		section := sm.Sections[idx]
+		if section.Map == nil {
+			if section.URL != "" {
+				return nil, pos, &SourceMapError{Err: fmt.Errorf("unsupported source map section url: %s", section.URL)}
+			}
+			return nil, pos, &SourceMapError{Err: fmt.Errorf("missing map in source map section %d", idx)}
+		}
 
-	result := "["
-	for i, s := range arr {
-		if i > 0 {
-			result += ","
+		// Offsets are zero-based; the column offset only applies to the
+		// first generated line of the section
+		if pos.Line == section.Offset.Line+1 {
+			pos.Column -= section.Offset.Column
 		}
-		result += fmt.Sprintf(`"%s"`, s)
+		pos.Line -= section.Offset.Line
+		sm = section.Map
+	}
+
+	return sm, pos, nil
+}
+
+// sectionStartsAfter reports whether a section with the given zero-based
+// offset starts after the one-based line position pos
+func sectionStartsAfter(offset Position, pos Position) bool {
+	if offset.Line+1 != pos.Line {
+		return offset.Line+1 > pos.Line
 	}
-	result += "]"
-	return result
+	return offset.Column > pos.Column
 }
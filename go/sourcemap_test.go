@@ -0,0 +1,331 @@
+package istanbul
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOriginalPositionIndexedSourceMap(t *testing.T) {
+	smt := NewSourceMapTransformer()
+
+	sm := &SourceMap{
+		Version: 3,
+		File:    "bundle.js",
+		Sections: []SourceMapSection{
+			{
+				Offset: Position{Line: 0, Column: 0},
+				Map: &SourceMap{
+					Version:  3,
+					Sources:  []string{"src/a.ts"},
+					Names:    []string{},
+					Mappings: "AAAA;AACA;AACA",
+				},
+			},
+			{
+				Offset: Position{Line: 2, Column: 10},
+				Map: &SourceMap{
+					Version:  3,
+					Sources:  []string{"src/b.ts"},
+					Names:    []string{},
+					Mappings: "AAAA;AACA",
+				},
+			},
+		},
+	}
+
+	// First section
+	mapping, err := smt.GetOriginalPosition(sm, Position{Line: 2, Column: 0})
+	require.NoError(t, err)
+	assert.Equal(t, "src/a.ts", mapping.Source)
+	assert.Equal(t, 2, mapping.Location.Start.Line)
+
+	// Column offset applies on the section's first line only
+	mapping, err = smt.GetOriginalPosition(sm, Position{Line: 3, Column: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "src/b.ts", mapping.Source)
+	assert.Equal(t, 1, mapping.Location.Start.Line)
+	assert.Equal(t, 0, mapping.Location.Start.Column)
+
+	mapping, err = smt.GetOriginalPosition(sm, Position{Line: 4, Column: 0})
+	require.NoError(t, err)
+	assert.Equal(t, "src/b.ts", mapping.Source)
+	assert.Equal(t, 2, mapping.Location.Start.Line)
+
+	// Before the second section starts on its first line
+	mapping, err = smt.GetOriginalPosition(sm, Position{Line: 3, Column: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "src/a.ts", mapping.Source)
+}
+
+func TestGetOriginalPositionNestedIndexedSourceMap(t *testing.T) {
+	smt := NewSourceMapTransformer()
+
+	sm := &SourceMap{
+		Version: 3,
+		Sections: []SourceMapSection{
+			{
+				Offset: Position{Line: 5, Column: 0},
+				Map: &SourceMap{
+					Version: 3,
+					Sections: []SourceMapSection{
+						{
+							Offset: Position{Line: 1, Column: 0},
+							Map: &SourceMap{
+								Version:  3,
+								Sources:  []string{"src/nested.ts"},
+								Names:    []string{},
+								Mappings: "AAAA",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	mapping, err := smt.GetOriginalPosition(sm, Position{Line: 7, Column: 0})
+	require.NoError(t, err)
+	assert.Equal(t, "src/nested.ts", mapping.Source)
+
+	_, err = smt.GetOriginalPosition(sm, Position{Line: 1, Column: 0})
+	assert.Error(t, err)
+}
+
+func TestTransformCoverageIndexedSourceMap(t *testing.T) {
+	coverageData := `{
+		"dist/bundle.js": {
+			"path": "dist/bundle.js",
+			"statementMap": {
+				"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 10}},
+				"1": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 10}}
+			},
+			"fnMap": {},
+			"branchMap": {},
+			"s": {"0": 1, "1": 2},
+			"f": {},
+			"b": {},
+			"inputSourceMap": {
+				"version": 3,
+				"file": "bundle.js",
+				"sections": [
+					{"offset": {"line": 0, "column": 0}, "map": {"version": 3, "sources": ["../src/a.ts"], "names": [], "mappings": "AAAA"}},
+					{"offset": {"line": 1, "column": 0}, "map": {"version": 3, "sources": ["../src/b.ts"], "names": [], "mappings": "AAAA"}}
+				]
+			}
+		}
+	}`
+
+	coverage, err := ParseCoverageMap([]byte(coverageData))
+	require.NoError(t, err)
+
+	result, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+	assert.Contains(t, result, filepath.Join("src", "a.ts"))
+	assert.Contains(t, result, filepath.Join("src", "b.ts"))
+}
+
+func TestSourceMapJSONRoundTrip(t *testing.T) {
+	input := `{
+		"version": 3,
+		"file": "bundle.js",
+		"sourceRoot": "webpack:///",
+		"sources": ["C:\\Users\\dev\\\"quoted\"\\a.ts", "webpack://app/./src/b.ts?query=\"x\"&y=1", "src/中文.ts"],
+		"sourcesContent": ["const a = \"a\";\n", "", null],
+		"names": ["a"],
+		"mappings": "AAAA",
+		"ignoreList": [1],
+		"x_google_ignoreList": [1],
+		"x_custom": {"nested": true}
+	}`
+
+	var sm SourceMap
+	require.NoError(t, json.Unmarshal([]byte(input), &sm))
+	assert.Equal(t, []int{1}, sm.IgnoreList)
+	assert.Contains(t, sm.Extensions, "x_google_ignoreList")
+	assert.Contains(t, sm.Extensions, "x_custom")
+
+	encoded, err := json.Marshal(&sm)
+	require.NoError(t, err)
+
+	var decoded SourceMap
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, sm, decoded)
+	assert.JSONEq(t, input, string(encoded))
+	assert.Nil(t, decoded.SourcesContent[2])
+
+	// Missing sources and names are written as empty arrays, except in
+	// index maps
+	require.NoError(t, json.Unmarshal([]byte(`{"version": 3, "mappings": ""}`), &sm))
+	encoded, err = json.Marshal(&sm)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": 3, "sources": [], "names": [], "mappings": ""}`, string(encoded))
+
+	indexed := `{"version": 3, "sources": null, "names": null, "mappings": "", "sections": [` +
+		`{"offset": {"line": 0, "column": 0}, "map": {"version": 3, "sources": [], "names": [], "mappings": ""}}]}`
+	require.NoError(t, json.Unmarshal([]byte(indexed), &sm))
+	encoded, err = json.Marshal(&sm)
+	require.NoError(t, err)
+	assert.JSONEq(t, indexed, string(encoded))
+}
+
+func TestGetOriginalPositionHostileSourcePaths(t *testing.T) {
+	smt := NewSourceMapTransformer()
+
+	sources := []string{
+		`C:\Users\dev\"quoted"\a.ts`,
+		`webpack://app/./src/b.ts?query="x"&y=1`,
+		"src/中文.ts",
+	}
+
+	for _, source := range sources {
+		sm := &SourceMap{
+			Version:  3,
+			File:     `dist\"bundle".js`,
+			Sources:  []string{source},
+			Names:    []string{`"name"`},
+			Mappings: "AAAAA",
+		}
+
+		mapping, err := smt.GetOriginalPosition(sm, Position{Line: 1, Column: 0})
+		require.NoError(t, err, source)
+		assert.Equal(t, source, mapping.Source)
+	}
+}
+
+func TestMapLocationUsesSegmentExtents(t *testing.T) {
+	smt := NewSourceMapTransformer()
+
+	// Generated line 1 has segments at columns 0, 8 and 16 mapping to
+	// src/main.ts 1:0, 2:2 and 2:20
+	sm := &SourceMap{
+		Version:  3,
+		Sources:  []string{"src/main.ts"},
+		Names:    []string{},
+		Mappings: "AAAA,QACE,QAAkB",
+	}
+
+	mapping, err := smt.MapLocation(sm, Location{
+		Start: Position{Line: 1, Column: 8},
+		End:   Position{Line: 1, Column: 16},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "src/main.ts", mapping.Source)
+	assert.Equal(t, Location{
+		Start: Position{Line: 2, Column: 2},
+		End:   Position{Line: 2, Column: 20},
+	}, mapping.Location)
+
+	// Starting on a column without a segment still maps to the preceding one,
+	// and without a later segment on its original line the range extends to
+	// the end of that line
+	mapping, err = smt.MapLocation(sm, Location{
+		Start: Position{Line: 1, Column: 3},
+		End:   Position{Line: 1, Column: 8},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Position{Line: 1, Column: 0}, mapping.Location.Start)
+	assert.Equal(t, Position{Line: 1, Column: EndOfLine}, mapping.Location.End)
+}
+
+func TestMapLocationSingleSegmentExtendsToEndOfLine(t *testing.T) {
+	sm := &SourceMap{Version: 3, Sources: []string{"a.ts"}, Names: []string{}, Mappings: "AAAA"}
+
+	mapping, err := NewSourceMapTransformer().MapLocation(sm, Location{
+		Start: Position{Line: 1, Column: 0},
+		End:   Position{Line: 1, Column: 5},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Location{
+		Start: Position{Line: 1, Column: 0},
+		End:   Position{Line: 1, Column: EndOfLine},
+	}, mapping.Location)
+}
+
+func TestPositionJSONEndOfLine(t *testing.T) {
+	data, err := json.Marshal(Location{Start: Position{Line: 1}, End: Position{Line: 1, Column: EndOfLine}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"start":{"line":1,"column":0},"end":{"line":1,"column":null}}`, string(data))
+
+	var loc Location
+	require.NoError(t, json.Unmarshal(data, &loc))
+	assert.Equal(t, EndOfLine, loc.End.Column)
+
+	// Missing fields stay zero, as in an implicit else
+	require.NoError(t, json.Unmarshal([]byte(`{"start":{},"end":{}}`), &loc))
+	assert.True(t, loc.isEmpty())
+}
+
+func TestDecodeMappings(t *testing.T) {
+	segments, err := decodeMappings("AAAA,QACE;AAAkB,C")
+	require.NoError(t, err)
+	require.Len(t, segments, 4)
+
+	assert.Equal(t, mapping{genLine: 1, genColumn: 8, source: 0, origLine: 2, origColumn: 2, name: -1}, segments[1])
+	assert.Equal(t, mapping{genLine: 2, genColumn: 0, source: 0, origLine: 2, origColumn: 20, name: -1}, segments[2])
+	assert.Equal(t, mapping{genLine: 2, genColumn: 1, source: -1, name: -1}, segments[3])
+
+	_, err = decodeMappings("AA!A")
+	assert.Error(t, err)
+
+	_, err = decodeMappings("AA")
+	assert.Error(t, err)
+}
+
+func TestOriginalPositionForBias(t *testing.T) {
+	smt := NewSourceMapTransformer()
+
+	// Generated line 1: unmapped segment at column 2, mapped segments at
+	// columns 4 and 12 (the latter named)
+	sm := &SourceMap{
+		Version:  3,
+		Sources:  []string{"src/main.ts"},
+		Names:    []string{"run"},
+		Mappings: "E,EAAA,QACEA",
+	}
+
+	mapping, err := smt.OriginalPositionFor(sm, Position{Line: 1, Column: 10}, LookupOptions{Bias: GreatestLowerBound})
+	require.NoError(t, err)
+	assert.Equal(t, Position{Line: 1, Column: 0}, mapping.Location.Start)
+
+	mapping, err = smt.OriginalPositionFor(sm, Position{Line: 1, Column: 10}, LookupOptions{Bias: LeastUpperBound})
+	require.NoError(t, err)
+	assert.Equal(t, Position{Line: 2, Column: 2}, mapping.Location.Start)
+	assert.Equal(t, "run", mapping.Name)
+
+	// Column 1 precedes every segment and the next one has no source
+	_, err = smt.OriginalPositionFor(sm, Position{Line: 1, Column: 1}, LookupOptions{Bias: GreatestLowerBound})
+	assert.Error(t, err)
+	_, err = smt.OriginalPositionFor(sm, Position{Line: 1, Column: 1}, LookupOptions{Bias: LeastUpperBound})
+	assert.Error(t, err)
+
+	mapping, err = smt.OriginalPositionFor(sm, Position{Line: 1, Column: 1}, LookupOptions{
+		Bias:          GreatestLowerBound,
+		SearchForward: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Position{Line: 1, Column: 0}, mapping.Location.Start)
+
+	// Lookups never cross generated lines
+	_, err = smt.OriginalPositionFor(sm, Position{Line: 2, Column: 0}, LookupOptions{Bias: GreatestLowerBound, SearchForward: true})
+	assert.Error(t, err)
+}
+
+func TestGetOriginalPositionSeesReusedSourceMap(t *testing.T) {
+	smt := NewSourceMapTransformer()
+
+	// Decoding into the same variable must not return the old sources
+	var sm SourceMap
+	require.NoError(t, json.Unmarshal([]byte(`{"version":3,"sources":["a.ts"],"names":[],"mappings":"AAAA"}`), &sm))
+	result, err := smt.GetOriginalPosition(&sm, Position{Line: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "a.ts", result.Source)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"version":3,"sources":["b.ts"],"names":[],"mappings":"AAAA"}`), &sm))
+	result, err = smt.GetOriginalPosition(&sm, Position{Line: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "b.ts", result.Source)
+}
@@ -0,0 +1,197 @@
+package istanbul
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecodeCoverage reads an Istanbul coverage JSON object from r and calls fn
+// with each file entry as soon as it is decoded, so that only one entry needs
+// to be held in memory at a time. Decoding stops at the first error returned
+// by fn.
+func DecodeCoverage(r io.Reader, fn func(path string, fc *FileCoverage) error) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read coverage data: %w", newJSONError(err))
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return &JSONError{Offset: dec.InputOffset(), Err: errors.New("coverage data must be a JSON object")}
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read coverage data: %w", newJSONError(err))
+		}
+		path := tok.(string) // Object keys are always strings
+
+		var fc *FileCoverage
+		if err := dec.Decode(&fc); err != nil {
+			return fmt.Errorf("failed to decode coverage for file %s: %w", path, newJSONError(err))
+		}
+		if err := fn(path, fc); err != nil {
+			return err
+		}
+	}
+
+	// Consume the closing brace
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read coverage data: %w", newJSONError(err))
+	}
+	return nil
+}
+
+// WriteJSON writes the coverage map to w as the same indented JSON as
+// ToJSON, encoding one file at a time
+func (cm CoverageMap) WriteJSON(w io.Writer) error {
+	if cm == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+
+	cw := newCoverageWriter(w)
+	for _, path := range sortedPaths(cm) {
+		if err := cw.write(path, cm[path]); err != nil {
+			return err
+		}
+	}
+	return cw.close()
+}
+
+// coverageWriter writes file entries one at a time as an indented JSON
+// object, nothing until the first entry or close
+type coverageWriter struct {
+	bw      *bufio.Writer
+	entries int
+}
+
+// newCoverageWriter creates a writer of a coverage JSON object to w
+func newCoverageWriter(w io.Writer) *coverageWriter {
+	return &coverageWriter{bw: bufio.NewWriter(w)}
+}
+
+// write writes the entry of one file
+func (cw *coverageWriter) write(path string, fc *FileCoverage) error {
+	key, err := json.Marshal(path)
+	if err != nil {
+		return err
+	}
+	value, err := json.MarshalIndent(fc, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode coverage for file %s: %w", path, err)
+	}
+
+	if cw.entries == 0 {
+		cw.bw.WriteByte('{')
+	} else {
+		cw.bw.WriteByte(',')
+	}
+	cw.entries++
+	cw.bw.WriteString("\n  ")
+	cw.bw.Write(key)
+	cw.bw.WriteString(": ")
+	_, err = cw.bw.Write(value)
+	return err
+}
+
+// close ends the object and flushes the output
+func (cw *coverageWriter) close() error {
+	if cw.entries == 0 {
+		cw.bw.WriteByte('{')
+	} else {
+		cw.bw.WriteByte('\n')
+	}
+	cw.bw.WriteByte('}')
+	return cw.bw.Flush()
+}
+
+// TransformStream transforms the coverage JSON read from r and writes the
+// result to w, one file entry at a time. An entry without a source map is
+// written, with its path rewritten, as soon as it is decoded. An entry with a
+// source map is transformed and its source map released; the coverage of the
+// original sources is kept, as later entries may map to the same sources, and
+// written sorted by path after the input ends. Peak memory is thus bounded by
+// the largest entry plus the transformed coverage, not by the whole input.
+//
+// The output holds the same entries as that of Transform, but in input order
+// followed by the transformed ones. Coverage that would have to be merged
+// into an entry already written, because paths coincide after rewriting or
+// transforming, fails with an error matching ErrAlreadyWritten; use Transform
+// for such input. Files are transformed one
+// at a time regardless of the number of workers. On error, w may hold part of
+// the output.
+func (ct *CoverageTransformer) TransformStream(ctx context.Context, r io.Reader, w io.Writer) error {
+	cw := newCoverageWriter(w)
+	b := newCoverageBuilder()
+	written := make(map[string]bool) // output paths already written
+	pending := make(map[string]bool) // output paths of the buffered coverage
+	completed := 0
+
+	err := DecodeCoverage(r, func(path string, fc *FileCoverage) error {
+		if err := ctx.Err(); err != nil {
+			return &CanceledError{Completed: completed, Err: err}
+		}
+		if fc == nil {
+			return nil // Skip null entries
+		}
+		if fc.InputSourceMap == nil {
+			outPath := rewritePath(path, &ct.options)
+			switch {
+			case written[outPath]:
+				return fmt.Errorf("%w: %s", ErrAlreadyWritten, outPath)
+			case pending[outPath]:
+				b.addInput(path, fc) // Merged with transformed coverage
+				return nil
+			}
+			written[outPath] = true
+			if err := cw.write(outPath, ct.rewritePaths(CoverageMap{path: fc})[outPath]); err != nil {
+				return fmt.Errorf("failed to serialize result: %w", err)
+			}
+			return nil
+		}
+
+		files, _, err := ct.transformFile(ctx, path, fc)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return &CanceledError{Completed: completed, Err: ctxErr}
+			}
+			return fmt.Errorf("failed to transform file %s: %w", path, err)
+		}
+		completed++
+		for source := range files {
+			outPath := rewritePath(source, &ct.options)
+			if written[outPath] {
+				return fmt.Errorf("%w: %s", ErrAlreadyWritten, outPath)
+			}
+			pending[outPath] = true
+		}
+		b.addTransformed(files)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	result := ct.finish(b)
+	for _, path := range sortedPaths(result) {
+		if err := cw.write(path, result[path]); err != nil {
+			return fmt.Errorf("failed to serialize result: %w", err)
+		}
+	}
+	if err := cw.close(); err != nil {
+		return fmt.Errorf("failed to serialize result: %w", err)
+	}
+	return nil
+}
+
+// TransformCoverageStream is a convenience function to transform coverage
+// data from r to w, one file entry at a time
+func TransformCoverageStream(ctx context.Context, r io.Reader, w io.Writer) error {
+	return NewCoverageTransformer().TransformStream(ctx, r, w)
+}
@@ -0,0 +1,182 @@
+package istanbul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamCoverage builds coverage with several bundles sharing one original
+// source and a file without a source map
+func streamCoverage() CoverageMap {
+	coverage := make(CoverageMap)
+	for i := 0; i < 3; i++ {
+		fc := largeBundleCoverage(20)["dist/bundle.js"]
+		fc.Path = fmt.Sprintf("dist/bundle%d.js", i)
+		coverage[fc.Path] = fc
+	}
+	coverage["src/plain.js"] = &FileCoverage{
+		Path:         "src/plain.js",
+		StatementMap: map[string]Location{"0": {Start: Position{Line: 1}, End: Position{Line: 1, Column: 5}}},
+		FnMap:        map[string]FunctionMeta{},
+		BranchMap:    map[string]BranchMeta{},
+		S:            map[string]int{"0": 2},
+		F:            map[string]int{},
+		B:            map[string][]int{},
+	}
+	return coverage
+}
+
+func TestDecodeCoverage(t *testing.T) {
+	data, err := json.Marshal(streamCoverage())
+	require.NoError(t, err)
+
+	var paths []string
+	err = DecodeCoverage(bytes.NewReader(data), func(path string, fc *FileCoverage) error {
+		paths = append(paths, path)
+		assert.Equal(t, path, fc.Path)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dist/bundle0.js", "dist/bundle1.js", "dist/bundle2.js", "src/plain.js"}, paths)
+
+	// Errors from the callback stop decoding
+	stop := errors.New("stop")
+	calls := 0
+	err = DecodeCoverage(bytes.NewReader(data), func(string, *FileCoverage) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDecodeCoverageInvalidInput(t *testing.T) {
+	for _, input := range []string{``, `[]`, `{"a.js": 1}`, `{"a.js": {}`} {
+		err := DecodeCoverage(strings.NewReader(input), func(string, *FileCoverage) error { return nil })
+		assert.Error(t, err, input)
+	}
+}
+
+func TestWriteJSONMatchesToJSON(t *testing.T) {
+	for _, cm := range []CoverageMap{nil, {}, streamCoverage()} {
+		want, err := cm.ToJSON()
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, cm.WriteJSON(&buf))
+		assert.Equal(t, string(want), buf.String())
+	}
+}
+
+// coverageJSON encodes the entries of coverage in the given path order
+func coverageJSON(t *testing.T, coverage CoverageMap, paths ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, path := range paths {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(path)
+		require.NoError(t, err)
+		value, err := json.Marshal(coverage[path])
+		require.NoError(t, err)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+func TestTransformStreamMatchesTransform(t *testing.T) {
+	coverage := streamCoverage()
+	data := coverageJSON(t, coverage, "dist/bundle0.js", "src/plain.js", "dist/bundle1.js", "dist/bundle2.js")
+
+	want, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, TransformCoverageStream(context.Background(), bytes.NewReader(data), &buf))
+	got, err := ParseCoverageMap(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// Entries without a source map come first, in input order, followed by
+	// the transformed ones
+	assert.True(t, strings.HasPrefix(buf.String(), "{\n  \"src/plain.js\": {"))
+	assert.Less(t, strings.Index(buf.String(), `"src/plain.js"`), strings.Index(buf.String(), `"src/app.ts"`))
+
+	buf.Reset()
+	require.NoError(t, New().TransformStream(context.Background(), bytes.NewReader(data), &buf))
+	got, err = ParseCoverageMap(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestTransformStreamWritesEntriesWithoutSourceMapEarly(t *testing.T) {
+	plain := largeBundleCoverage(200)["dist/bundle.js"]
+	plain.InputSourceMap = nil
+	data := coverageJSON(t, CoverageMap{"dist/plain.js": plain}, "dist/plain.js")
+
+	// The entry is written before the input turns out to be truncated
+	var buf bytes.Buffer
+	err := TransformCoverageStream(context.Background(), bytes.NewReader(data[:len(data)-1]), &buf)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+	assert.True(t, strings.HasPrefix(buf.String(), "{\n  \"dist/plain.js\": {"))
+}
+
+func TestTransformStreamMergesEntriesOnTheSamePath(t *testing.T) {
+	coverage := streamCoverage()
+	plain := coverage["src/plain.js"]
+	plain.Path = "src/app.ts"
+	coverage["src/app.ts"] = plain
+	delete(coverage, "src/plain.js")
+
+	want, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+
+	// An entry on the path of transformed coverage is merged with it
+	var buf bytes.Buffer
+	data := coverageJSON(t, coverage, "dist/bundle0.js", "src/app.ts", "dist/bundle1.js", "dist/bundle2.js")
+	require.NoError(t, TransformCoverageStream(context.Background(), bytes.NewReader(data), &buf))
+	got, err := ParseCoverageMap(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// Unless it was already written when the transformed coverage appears
+	buf.Reset()
+	data = coverageJSON(t, coverage, "src/app.ts", "dist/bundle0.js", "dist/bundle1.js", "dist/bundle2.js")
+	err = TransformCoverageStream(context.Background(), bytes.NewReader(data), &buf)
+	assert.ErrorIs(t, err, ErrAlreadyWritten)
+	assert.ErrorContains(t, err, "src/app.ts")
+
+	// Or already written under its rewritten path
+	data = coverageJSON(t, CoverageMap{"/a/x.js": plain, "/b/x.js": plain}, "/a/x.js", "/b/x.js")
+	ct := NewCoverageTransformer(WithPathRewrites(PrefixRewrite("/a/", ""), PrefixRewrite("/b/", "")))
+	err = ct.TransformStream(context.Background(), bytes.NewReader(data), &buf)
+	assert.ErrorIs(t, err, ErrAlreadyWritten)
+}
+
+func TestTransformStreamCanceled(t *testing.T) {
+	data, err := json.Marshal(streamCoverage())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	err = TransformCoverageStream(ctx, bytes.NewReader(data), &buf)
+	var canceled *CanceledError
+	require.ErrorAs(t, err, &canceled)
+	assert.Equal(t, 0, canceled.Completed)
+	assert.Equal(t, "transform canceled after 0 files: context canceled", canceled.Error())
+	assert.Zero(t, buf.Len())
+}
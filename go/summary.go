@@ -0,0 +1,159 @@
+package istanbul
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"path"
+	"path/filepath"
+)
+
+// Totals holds the total, covered and skipped items of one kind and the
+// covered percentage, truncated to two decimals and 100 when there are no
+// items, as istanbul-lib-coverage computes it
+type Totals struct {
+	Total   int     `json:"total"`
+	Covered int     `json:"covered"`
+	Skipped int     `json:"skipped"`
+	Pct     float64 `json:"pct"`
+}
+
+// count adds an item with the given hits. As in istanbul-lib-coverage, a
+// skipped item counts as covered, and as skipped when it was not hit.
+func (t *Totals) count(hits int, skip bool) {
+	t.Total++
+	if hits > 0 || skip {
+		t.Covered++
+	}
+	if hits <= 0 && skip {
+		t.Skipped++
+	}
+	t.Pct = percent(t.Covered, t.Total)
+}
+
+// add adds the items of other
+func (t *Totals) add(other Totals) {
+	t.Total += other.Total
+	t.Covered += other.Covered
+	t.Skipped += other.Skipped
+	t.Pct = percent(t.Covered, t.Total)
+}
+
+// Summary holds the coverage totals of a file or a group of files, like the
+// coverage summary of istanbul-lib-coverage. Lines are derived from the
+// statements as in LineCoverage.
+type Summary struct {
+	Lines      Totals `json:"lines"`
+	Statements Totals `json:"statements"`
+	Functions  Totals `json:"functions"`
+	Branches   Totals `json:"branches"`
+}
+
+// Merge adds the totals of other to the summary
+func (s *Summary) Merge(other Summary) {
+	s.Lines.add(other.Lines)
+	s.Statements.add(other.Statements)
+	s.Functions.add(other.Functions)
+	s.Branches.add(other.Branches)
+}
+
+// emptySummary returns the summary of no files, with every percentage 100
+func emptySummary() Summary {
+	empty := Totals{Pct: percent(0, 0)}
+	return Summary{
+		Lines:      empty,
+		Statements: empty,
+		Functions:  empty,
+		Branches:   empty,
+	}
+}
+
+// Summary computes the coverage totals of the file. Statements, functions
+// and branch locations marked skip count as covered; lines ignore it.
+func (fc *FileCoverage) Summary() Summary {
+	s := emptySummary()
+	for _, hits := range fc.LineCoverage() {
+		s.Lines.count(hits, false)
+	}
+	for id, hits := range fc.S {
+		s.Statements.count(hits, fc.StatementMap[id].Skip)
+	}
+	for id, hits := range fc.F {
+		s.Functions.count(hits, fc.FnMap[id].Skip)
+	}
+	for id, hits := range fc.B {
+		locations := fc.BranchMap[id].Locations
+		for i, h := range hits {
+			s.Branches.count(h, i < len(locations) && locations[i].Skip)
+		}
+	}
+	return s
+}
+
+// Summary computes the coverage totals of all files
+func (cm CoverageMap) Summary() Summary {
+	s := emptySummary()
+	for _, fc := range cm {
+		if fc != nil {
+			s.Merge(fc.Summary())
+		}
+	}
+	return s
+}
+
+// DirectorySummaries computes the coverage totals of each directory holding
+// files, keyed by the slash-separated directory of the file paths. Like the
+// packages of istanbul reports, a directory only counts the files directly
+// inside it.
+func (cm CoverageMap) DirectorySummaries() map[string]Summary {
+	result := make(map[string]Summary)
+	for key, fc := range cm {
+		if fc == nil {
+			continue
+		}
+		dir := path.Dir(filepath.ToSlash(fc.pathOr(key)))
+		s, exists := result[dir]
+		if !exists {
+			s = emptySummary()
+		}
+		s.Merge(fc.Summary())
+		result[dir] = s
+	}
+	return result
+}
+
+// WriteJSONSummary writes the coverage summary in the coverage-summary.json
+// format of the json-summary reporter of istanbul: the totals under "total"
+// followed by the summary of each file under its path, one entry per line
+func (cm CoverageMap) WriteJSONSummary(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	write := func(sep, key string, s Summary) error {
+		keyJSON, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		summaryJSON, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(sep)
+		bw.Write(keyJSON)
+		bw.WriteString(": ")
+		bw.Write(summaryJSON)
+		bw.WriteByte('\n')
+		return nil
+	}
+
+	if err := write("{", "total", cm.Summary()); err != nil {
+		return err
+	}
+	for _, key := range sortedPaths(cm) {
+		if fc := cm[key]; fc != nil {
+			if err := write(",", fc.pathOr(key), fc.Summary()); err != nil {
+				return err
+			}
+		}
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
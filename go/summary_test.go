@@ -0,0 +1,108 @@
+package istanbul
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCoverageSummary(t *testing.T) {
+	s := reporterCoverage()["src/a.ts"].Summary()
+	assert.Equal(t, Summary{
+		Lines:      Totals{Total: 5, Covered: 4, Pct: 80},
+		Statements: Totals{Total: 6, Covered: 4, Pct: 66.66},
+		Functions:  Totals{Total: 2, Covered: 1, Pct: 50},
+		Branches:   Totals{Total: 2, Covered: 1, Pct: 50},
+	}, s)
+
+	// Nothing to cover counts as fully covered
+	empty := reporterCoverage()["src/b.ts"].Summary()
+	assert.Equal(t, Totals{Pct: 100}, empty.Lines)
+	assert.Equal(t, Totals{Pct: 100}, empty.Branches)
+}
+
+func TestFileCoverageSummarySkippedItems(t *testing.T) {
+	var coverage CoverageMap
+	require.NoError(t, json.Unmarshal([]byte(`{"dist/app.js": {
+		"path": "dist/app.js",
+		"statementMap": {
+			"0": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 5}},
+			"1": {"start": {"line": 1, "column": 6}, "end": {"line": 1, "column": 9}, "skip": true},
+			"2": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 5}, "skip": true}
+		},
+		"fnMap": {"0": {"name": "f", "decl": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 5}},
+			"loc": {"start": {"line": 2, "column": 0}, "end": {"line": 2, "column": 5}}, "skip": true}},
+		"branchMap": {"0": {"type": "if", "loc": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 5}},
+			"locations": [{"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 5}},
+				{"start": {"line": 1, "column": 6}, "end": {"line": 1, "column": 9}, "skip": true}]}},
+		"s": {"0": 0, "1": 1, "2": 0},
+		"f": {"0": 0},
+		"b": {"0": [0, 0]}
+	}}`), &coverage))
+
+	// Skipped items count as covered, and as skipped when not hit
+	s := coverage["dist/app.js"].Summary()
+	assert.Equal(t, Totals{Total: 2, Covered: 1, Pct: 50}, s.Lines)
+	assert.Equal(t, Totals{Total: 3, Covered: 2, Skipped: 1, Pct: 66.66}, s.Statements)
+	assert.Equal(t, Totals{Total: 1, Covered: 1, Skipped: 1, Pct: 100}, s.Functions)
+	assert.Equal(t, Totals{Total: 2, Covered: 1, Skipped: 1, Pct: 50}, s.Branches)
+
+	// The flags survive transformation
+	coverage["dist/app.js"].InputSourceMap = &SourceMap{
+		Version:  3,
+		Sources:  []string{"../src/a.ts"},
+		Names:    []string{},
+		Mappings: "AAAA,MAAM;AACA",
+	}
+	result, err := NewCoverageTransformer().Transform(coverage)
+	require.NoError(t, err)
+	require.Contains(t, result, "src/a.ts")
+	assert.Equal(t, s, result["src/a.ts"].Summary())
+}
+
+func TestCoverageMapSummaries(t *testing.T) {
+	coverage := reporterCoverage()
+	coverage["index.ts"] = &FileCoverage{
+		Path:         "index.ts",
+		StatementMap: map[string]Location{"0": {Start: Position{Line: 1}, End: Position{Line: 1, Column: 9}}},
+		S:            map[string]int{"0": 0},
+	}
+
+	total := coverage.Summary()
+	assert.Equal(t, Totals{Total: 6, Covered: 4, Pct: 66.66}, total.Lines)
+	assert.Equal(t, Totals{Total: 7, Covered: 4, Pct: 57.14}, total.Statements)
+	assert.Equal(t, Totals{Total: 2, Covered: 1, Pct: 50}, total.Functions)
+
+	dirs := coverage.DirectorySummaries()
+	require.Len(t, dirs, 2)
+	assert.Equal(t, reporterCoverage()["src/a.ts"].Summary(), dirs["src"])
+	assert.Equal(t, Totals{Total: 1, Pct: 0}, dirs["."].Lines)
+
+	assert.Equal(t, emptySummary(), CoverageMap{}.Summary())
+}
+
+func TestWriteJSONSummary(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, reporterCoverage().WriteJSONSummary(&buf))
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	require.Len(t, lines, 4)
+	assert.Equal(t, `{"total": {`+
+		`"lines":{"total":5,"covered":4,"skipped":0,"pct":80},`+
+		`"statements":{"total":6,"covered":4,"skipped":0,"pct":66.66},`+
+		`"functions":{"total":2,"covered":1,"skipped":0,"pct":50},`+
+		`"branches":{"total":2,"covered":1,"skipped":0,"pct":50}}`, string(lines[0]))
+	assert.Equal(t, `,"src/b.ts": {`+
+		`"lines":{"total":0,"covered":0,"skipped":0,"pct":100},`+
+		`"statements":{"total":0,"covered":0,"skipped":0,"pct":100},`+
+		`"functions":{"total":0,"covered":0,"skipped":0,"pct":100},`+
+		`"branches":{"total":0,"covered":0,"skipped":0,"pct":100}}`, string(lines[2]))
+	assert.Equal(t, "}", string(lines[3]))
+
+	var summaries map[string]Summary
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &summaries))
+	assert.Equal(t, reporterCoverage()["src/a.ts"].Summary(), summaries["src/a.ts"])
+}
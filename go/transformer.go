@@ -1,187 +1,641 @@
 package istanbul
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strconv"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 // CoverageTransformer transforms Istanbul coverage data using source maps
 type CoverageTransformer struct {
 	sourceMapTransformer *SourceMapTransformer
+	options              TransformOptions
+	filter               *globMatcher
 }
 
 // NewCoverageTransformer creates a new coverage transformer
-func NewCoverageTransformer() *CoverageTransformer {
-	return &CoverageTransformer{
-		sourceMapTransformer: NewSourceMapTransformer(),
+func NewCoverageTransformer(opts ...Option) *CoverageTransformer {
+	options := newTransformOptions(opts)
+	if options.Cache == nil {
+		options.Cache = NewConsumerCache(DefaultCacheSize)
 	}
+
+	ct := &CoverageTransformer{
+		sourceMapTransformer: NewSourceMapTransformerWithCache(options.Cache),
+		options:              options,
+	}
+	if len(ct.options.Include) > 0 || len(ct.options.Exclude) > 0 {
+		ct.filter = newGlobMatcher(ct.options.Include, ct.options.Exclude)
+	}
+	return ct
+}
+
+// Cache returns the cache of parsed source maps used by the transformer
+func (ct *CoverageTransformer) Cache() *ConsumerCache {
+	return ct.options.Cache
 }
 
+// cancelCheckInterval is the number of statements, functions or branches
+// transformed between checks for cancellation
+const cancelCheckInterval = 1024
+
 // Transform transforms coverage data using source maps
 func (ct *CoverageTransformer) Transform(coverage CoverageMap) (CoverageMap, error) {
-	result := make(CoverageMap)
+	return ct.TransformContext(context.Background(), coverage)
+}
+
+// TransformContext transforms coverage data using source maps, stopping with
+// a *CanceledError when ctx is done
+func (ct *CoverageTransformer) TransformContext(ctx context.Context, coverage CoverageMap) (CoverageMap, error) {
+	result, _, err := ct.TransformWithReport(ctx, coverage)
+	return result, err
+}
+
+// TransformWithReport is like TransformContext and also reports, for each
+// generated file with a source map, which items were mapped or dropped
+func (ct *CoverageTransformer) TransformWithReport(ctx context.Context, coverage CoverageMap) (CoverageMap, *TransformReport, error) {
+	// Transform files with source maps, possibly concurrently
+	paths := sortedPaths(coverage)
+	transformed, reports, err := ct.transformFiles(ctx, coverage, paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &TransformReport{Files: make(map[string]*FileReport)}
+	for _, fr := range reports {
+		if fr != nil {
+			report.Files[fr.Path] = fr
+		}
+	}
+
+	// Merge in a fixed order so the result is deterministic
+	b := newCoverageBuilder()
+	for i, filePath := range paths {
+		switch fc := coverage[filePath]; {
+		case fc == nil:
+			// Skip null entries
+		case fc.InputSourceMap == nil:
+			b.addInput(filePath, fc)
+		default:
+			b.addTransformed(transformed[i])
+		}
+	}
+
+	return ct.finish(b), report, nil
+}
+
+// coverageBuilder merges the coverage of input files without a source map
+// and of transformed files into one CoverageMap
+type coverageBuilder struct {
+	result    CoverageMap
+	inputs    map[string]bool        // result entries shared with the input
+	untouched map[*FileCoverage]bool // input coverage kept as is
+}
+
+// newCoverageBuilder creates an empty builder
+func newCoverageBuilder() *coverageBuilder {
+	return &coverageBuilder{
+		result:    make(CoverageMap),
+		inputs:    make(map[string]bool),
+		untouched: make(map[*FileCoverage]bool),
+	}
+}
+
+// addInput adds the coverage of a file without a source map, keeping it
+// unless another file has the same path
+func (b *coverageBuilder) addInput(filePath string, fc *FileCoverage) {
+	b.untouched[fc] = true
+	if existing, exists := b.result[filePath]; exists {
+		b.mergeInto(filePath, existing, fc)
+		return
+	}
+	b.result[filePath] = fc
+	b.inputs[filePath] = true
+}
+
+// addTransformed adds the original files produced by transforming one file
+func (b *coverageBuilder) addTransformed(files map[string]*FileCoverage) {
+	for _, path := range sortedPaths(files) {
+		fc := files[path]
+		if existing, exists := b.result[path]; exists {
+			b.mergeInto(path, existing, fc)
+		} else {
+			b.result[path] = fc
+		}
+	}
+}
+
+// mergeInto merges fc into the existing entry at path, copying it first if
+// it belongs to the caller
+func (b *coverageBuilder) mergeInto(path string, existing, fc *FileCoverage) {
+	if b.inputs[path] {
+		existing = existing.clone()
+		b.result[path] = existing
+		delete(b.inputs, path)
+	}
+	existing.Merge(fc)
+}
+
+// finish rewrites the paths of the built coverage and gives every entry
+// built by the transformer IDs in original source order, a schema and a hash
+func (ct *CoverageTransformer) finish(b *coverageBuilder) CoverageMap {
+	// Rewriting copies the entries, so track the built ones by their new path
+	built := make(map[string]bool)
+	for filePath, fc := range b.result {
+		if !b.untouched[fc] {
+			built[rewritePath(filePath, &ct.options)] = true
+		}
+	}
 
-	for filePath, fileCoverage := range coverage {
-		if fileCoverage.InputSourceMap == nil {
-			// No source map, keep original
-			result[filePath] = fileCoverage
+	result := ct.rewritePaths(b.result)
+	for filePath, fc := range result {
+		if !built[filePath] {
 			continue
 		}
+		fc.renumber()
+		if fc.CoverageSchema == "" {
+			fc.CoverageSchema = defaultCoverageSchema
+		}
+		if fc.Hash == "" {
+			fc.Hash = fc.computeHash()
+		}
+	}
+	return result
+}
 
-		// Transform this file's coverage
-		transformedFiles, err := ct.transformFile(fileCoverage)
-		if err != nil {
-			return nil, fmt.Errorf("failed to transform file %s: %w", filePath, err)
+// transformFiles transforms the files of coverage that have a source map,
+// using the configured number of workers. The results and reports are indexed
+// like paths.
+func (ct *CoverageTransformer) transformFiles(
+	ctx context.Context, coverage CoverageMap, paths []string,
+) ([]map[string]*FileCoverage, []*FileReport, error) {
+	results := make([]map[string]*FileCoverage, len(paths))
+	reports := make([]*FileReport, len(paths))
+	errs := make([]error, len(paths))
+
+	total := 0
+	for _, fc := range coverage {
+		if fc != nil && fc.InputSourceMap != nil {
+			total++
 		}
+	}
 
-		// Merge transformed files into result
-		for path, fc := range transformedFiles {
-			if existing, exists := result[path]; exists {
-				// Merge with existing coverage
-				ct.mergeCoverage(existing, fc)
-			} else {
-				result[path] = fc
+	var completed atomic.Int64
+	transform := func(i int) {
+		if fc := coverage[paths[i]]; fc != nil && fc.InputSourceMap != nil {
+			results[i], reports[i], errs[i] = ct.transformFile(ctx, paths[i], fc)
+			if errs[i] == nil {
+				completed.Add(1)
 			}
 		}
 	}
 
-	return result, nil
+	if ct.options.Workers <= 1 {
+		for i := range paths {
+			if ctx.Err() != nil {
+				break
+			}
+			transform(i)
+			if errs[i] != nil {
+				break
+			}
+		}
+	} else {
+		var (
+			wg     sync.WaitGroup
+			failed atomic.Bool
+			next   = make(chan int)
+		)
+		for w := 0; w < ct.options.Workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					if failed.Load() || ctx.Err() != nil {
+						continue // Drain remaining work after a failure
+					}
+					transform(i)
+					if errs[i] != nil {
+						failed.Store(true)
+					}
+				}
+			}()
+		}
+	dispatch:
+		for i := range paths {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		close(next)
+		wg.Wait()
+	}
+
+	if err := ctx.Err(); err != nil && int(completed.Load()) < total {
+		return nil, nil, &CanceledError{Completed: int(completed.Load()), Total: total, Err: err}
+	}
+
+	// Report the first failing file in path order
+	for i, err := range errs {
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to transform file %s: %w", paths[i], err)
+		}
+	}
+	return results, reports, nil
+}
+
+// rewritePaths applies the configured path rewrites and project root to the
+// keys and paths of the result, merging entries that end up on the same path
+func (ct *CoverageTransformer) rewritePaths(coverage CoverageMap) CoverageMap {
+	if len(ct.options.PathRewrites) == 0 && ct.options.ProjectRoot == "" {
+		return coverage
+	}
+
+	result := make(CoverageMap, len(coverage))
+	cloned := make(map[string]bool)
+	for _, filePath := range sortedPaths(coverage) {
+		fc := coverage[filePath]
+		newPath := rewritePath(filePath, &ct.options)
+		if fc.Path != filePath || newPath != filePath {
+			rewritten := *fc
+			rewritten.Path = rewritePath(fc.Path, &ct.options)
+			fc = &rewritten
+		}
+
+		existing, exists := result[newPath]
+		if !exists {
+			result[newPath] = fc
+			continue
+		}
+
+		// Merge into a copy so the caller's coverage is not modified
+		if !cloned[newPath] {
+			existing = existing.clone()
+			result[newPath] = existing
+			cloned[newPath] = true
+		}
+		existing.Merge(fc)
+	}
+
+	return result
 }
 
-// transformFile transforms a single file's coverage data
-func (ct *CoverageTransformer) transformFile(fc *FileCoverage) (map[string]*FileCoverage, error) {
+// transformFile transforms a single file's coverage data, stored under key in
+// the coverage map
+func (ct *CoverageTransformer) transformFile(
+	ctx context.Context, key string, fc *FileCoverage,
+) (map[string]*FileCoverage, *FileReport, error) {
 	if fc.InputSourceMap == nil {
-		return map[string]*FileCoverage{fc.Path: fc}, nil
+		return map[string]*FileCoverage{fc.Path: fc}, nil, nil
 	}
 
-	result := make(map[string]*FileCoverage)
+	ft := &fileTransform{
+		ctx:     ctx,
+		fc:      fc,
+		smt:     ct.sourceMapTransformer.fork(),
+		result:  make(map[string]*FileCoverage),
+		targets: make(map[string]*coverageIndex),
+		indexes: make(map[string]*coverageIndex),
+		strict:  ct.options.Strict,
+		report: &FileReport{
+			Path:       fc.Path,
+			Statements: ItemReport{Total: len(fc.StatementMap)},
+			Functions:  ItemReport{Total: len(fc.FnMap)},
+			Branches:   ItemReport{Total: len(fc.BranchMap)},
+			Sources:    []string{},
+		},
+	}
+	if ct.options.HonorIgnoreList {
+		ft.ignored = ignoredSources(fc.InputSourceMap)
+	}
+
+	// Fail on broken source maps rather than dropping all their items
+	if err := ft.smt.checkSourceMap(fc.InputSourceMap); err != nil {
+		var smErr *SourceMapError
+		if errors.As(err, &smErr) {
+			return nil, nil, &SourceMapError{File: key, Err: smErr.Err}
+		}
+		return nil, nil, err
+	}
 
 	// Transform statements
-	if err := ct.transformStatements(fc, result); err != nil {
-		return nil, err
+	if err := ct.transformStatements(ft); err != nil {
+		return nil, nil, err
 	}
 
 	// Transform functions
-	if err := ct.transformFunctions(fc, result); err != nil {
-		return nil, err
+	if err := ct.transformFunctions(ft); err != nil {
+		return nil, nil, err
 	}
 
 	// Transform branches
-	if err := ct.transformBranches(fc, result); err != nil {
-		return nil, err
+	if err := ct.transformBranches(ft); err != nil {
+		return nil, nil, err
 	}
 
-	return result, nil
+	// Report the output paths of the original files produced
+	seen := make(map[string]bool)
+	for _, path := range sortedPaths(ft.result) {
+		if p := rewritePath(path, &ct.options); !seen[p] {
+			seen[p] = true
+			ft.report.Sources = append(ft.report.Sources, p)
+		}
+	}
+	sort.Strings(ft.report.Sources)
+
+	return ft.result, ft.report, nil
+}
+
+// fileTransform holds the state of transforming a single generated file
+type fileTransform struct {
+	ctx     context.Context
+	fc      *FileCoverage             // generated file coverage
+	smt     *SourceMapTransformer     // source map lookups for this file
+	result  map[string]*FileCoverage  // original path -> transformed coverage
+	targets map[string]*coverageIndex // original source -> target, nil if filtered out
+	indexes map[string]*coverageIndex // original path -> target
+	ignored map[string]bool           // sources in the source map ignore list
+	report  *FileReport               // mapped and dropped item counts
+	strict  bool                      // fail instead of dropping items
+}
+
+// canceled returns the context error every cancelCheckInterval items
+func (ft *fileTransform) canceled(n int) error {
+	if n%cancelCheckInterval != 0 {
+		return nil
+	}
+	return ft.ctx.Err()
+}
+
+// targetFor returns the index of the FileCoverage collecting items mapped to
+// source, or nil if the source is filtered out
+func (ct *CoverageTransformer) targetFor(ft *fileTransform, source string) *coverageIndex {
+	if target, exists := ft.targets[source]; exists {
+		return target
+	}
+
+	var target *coverageIndex
+	path := ResolveSourcePath(source, ft.fc.Path)
+	if !ft.ignored[source] && ct.includePath(rewritePath(path, &ct.options)) {
+		// Different sources may resolve to the same path
+		target = ft.indexes[path]
+		if target == nil {
+			fc := ct.getOrCreateFileCoverage(ft.result, path)
+			fc.CoverageSchema = ft.fc.CoverageSchema // Same instrumenter
+			target = newCoverageIndex(fc)
+			ft.indexes[path] = target
+		}
+	}
+	ft.targets[source] = target
+	return target
+}
+
+// drop records an item dropped for reason. In strict mode it returns a
+// *MappingError instead; filtered items are recorded with items.drop.
+func (ft *fileTransform) drop(items *ItemReport, kind, id string, reason DropReason, err error) error {
+	if ft.strict {
+		return &MappingError{File: ft.fc.Path, Kind: kind, ID: id, Reason: reason, Err: err}
+	}
+	items.drop(reason)
+	return nil
+}
+
+// mapLocation maps a generated location to its original source. The reason
+// explains the error or, without one, why the location was cut down to the
+// mapping of its start.
+func (ft *fileTransform) mapLocation(loc Location) (*MappingResult, DropReason, error) {
+	mapping, fallback, err := ft.smt.mapLocation(ft.fc.InputSourceMap, loc, ft.strict)
+	if errors.Is(err, errCrossSource) {
+		return nil, DropCrossSource, err
+	}
+	if err != nil {
+		return nil, DropNoMapping, err
+	}
+	return mapping, fallback, nil
 }
 
 // transformStatements transforms statement coverage
-func (ct *CoverageTransformer) transformStatements(fc *FileCoverage, result map[string]*FileCoverage) error {
-	for stmtID, loc := range fc.StatementMap {
+func (ct *CoverageTransformer) transformStatements(ft *fileTransform) error {
+	fc := ft.fc
+	report := &ft.report.Statements
+	for n, stmtID := range sortedIDs(fc.StatementMap) {
+		if err := ft.canceled(n); err != nil {
+			return err
+		}
+		loc := fc.StatementMap[stmtID]
 		hits, exists := fc.S[stmtID]
 		if !exists {
+			if err := ft.drop(report, "statement", stmtID, DropMissingHits, nil); err != nil {
+				return err
+			}
 			continue
 		}
 
 		// Map location to original source
-		mapping, err := ct.sourceMapTransformer.MapLocation(fc.InputSourceMap, loc)
+		mapping, reason, err := ft.mapLocation(loc)
 		if err != nil {
+			if err := ft.drop(report, "statement", stmtID, reason, err); err != nil {
+				return err
+			}
 			continue // Skip unmappable statements
 		}
 
 		// Get or create file coverage for the original source
-		targetFC := ct.getOrCreateFileCoverage(result, mapping.Source)
+		target := ct.targetFor(ft, mapping.Source)
+		if target == nil {
+			report.drop(DropFiltered)
+			continue // Skip filtered sources
+		}
 
-		// Add statement to target file
-		newStmtID := ct.getNextID(targetFC.StatementMap)
-		targetFC.StatementMap[newStmtID] = mapping.Location
-		targetFC.S[newStmtID] = hits
+		// Add statement to target file, merging identical locations
+		mapped := mapping.Location
+		mapped.Skip = loc.Skip
+		target.addStatement(mapped, hits)
+		report.Mapped++
+		if reason != "" {
+			report.partial(reason)
+		}
 	}
 
 	return nil
 }
 
 // transformFunctions transforms function coverage
-func (ct *CoverageTransformer) transformFunctions(fc *FileCoverage, result map[string]*FileCoverage) error {
-	for fnID, fnMeta := range fc.FnMap {
+func (ct *CoverageTransformer) transformFunctions(ft *fileTransform) error {
+	fc := ft.fc
+	report := &ft.report.Functions
+	for n, fnID := range sortedIDs(fc.FnMap) {
+		if err := ft.canceled(n); err != nil {
+			return err
+		}
+		fnMeta := fc.FnMap[fnID]
 		hits, exists := fc.F[fnID]
 		if !exists {
+			if err := ft.drop(report, "function", fnID, DropMissingHits, nil); err != nil {
+				return err
+			}
 			continue
 		}
 
 		// Map function declaration location
-		declMapping, err := ct.sourceMapTransformer.MapLocation(fc.InputSourceMap, fnMeta.Decl)
+		declMapping, reason, err := ft.mapLocation(fnMeta.Decl)
 		if err != nil {
+			if err := ft.drop(report, "function", fnID, reason, err); err != nil {
+				return err
+			}
 			continue // Skip unmappable functions
 		}
+		var partial []DropReason // reasons of the parts left out
+		if reason != "" {
+			partial = append(partial, reason)
+		}
 
 		// Map function body location
-		locMapping, err := ct.sourceMapTransformer.MapLocation(fc.InputSourceMap, fnMeta.Loc)
-		if err != nil {
-			locMapping = declMapping // Use declaration mapping if body mapping fails
+		locMapping, reason, err := ft.mapLocation(fnMeta.Loc)
+		if err == nil && declMapping.Source != locMapping.Source {
+			reason, err = DropCrossSource, errCrossSource
 		}
-
-		// Ensure both mappings are to the same source
-		if declMapping.Source != locMapping.Source {
+		if err != nil {
+			if ft.strict {
+				return ft.drop(report, "function", fnID, reason, err)
+			}
+			// Use declaration mapping if body mapping fails or maps to
+			// another source
 			locMapping = declMapping
 		}
+		if reason != "" {
+			partial = append(partial, reason)
+		}
 
 		// Get or create file coverage for the original source
-		targetFC := ct.getOrCreateFileCoverage(result, declMapping.Source)
+		target := ct.targetFor(ft, declMapping.Source)
+		if target == nil {
+			report.drop(DropFiltered)
+			continue // Skip filtered sources
+		}
 
-		// Add function to target file
-		newFnID := ct.getNextID(targetFC.FnMap)
-		targetFC.FnMap[newFnID] = FunctionMeta{
+		// Add function to target file, merging identical functions
+		target.addFunction(FunctionMeta{
 			Name: fnMeta.Name,
 			Decl: declMapping.Location,
 			Loc:  locMapping.Location,
+			Skip: fnMeta.Skip,
+		}, hits)
+		report.Mapped++
+		for _, reason := range partial {
+			report.partial(reason)
 		}
-		targetFC.F[newFnID] = hits
 	}
 
 	return nil
 }
 
 // transformBranches transforms branch coverage
-func (ct *CoverageTransformer) transformBranches(fc *FileCoverage, result map[string]*FileCoverage) error {
-	for branchID, branchMeta := range fc.BranchMap {
+func (ct *CoverageTransformer) transformBranches(ft *fileTransform) error {
+	fc := ft.fc
+	report := &ft.report.Branches
+	for n, branchID := range sortedIDs(fc.BranchMap) {
+		if err := ft.canceled(n); err != nil {
+			return err
+		}
+		branchMeta := fc.BranchMap[branchID]
 		hits, exists := fc.B[branchID]
 		if !exists {
+			if err := ft.drop(report, "branch", branchID, DropMissingHits, nil); err != nil {
+				return err
+			}
 			continue
 		}
+		if ft.strict && len(hits) != len(branchMeta.Locations) {
+			return ft.drop(report, "branch", branchID, DropHitCountMismatch,
+				fmt.Errorf("%d hit counts for %d locations", len(hits), len(branchMeta.Locations)))
+		}
 
 		// Map branch location
-		locMapping, err := ct.sourceMapTransformer.MapLocation(fc.InputSourceMap, branchMeta.Loc)
+		locMapping, reason, err := ft.mapLocation(branchMeta.Loc)
 		if err != nil {
+			if err := ft.drop(report, "branch", branchID, reason, err); err != nil {
+				return err
+			}
 			continue // Skip unmappable branches
 		}
+		var partial []DropReason // reasons of the parts left out
+		if reason != "" {
+			partial = append(partial, reason)
+		}
 
-		// Map branch locations
+		// Map branch locations, keeping the hits of each mapped one
 		var mappedLocations []Location
-		for _, branchLoc := range branchMeta.Locations {
-			branchMapping, err := ct.sourceMapTransformer.MapLocation(fc.InputSourceMap, branchLoc)
+		var mappedHits []int
+		crossSource := false
+		for i, branchLoc := range branchMeta.Locations {
+			var branchMapping *MappingResult
+			var reason DropReason
+			var err error
+			if branchLoc.isEmpty() {
+				// An implicit else has no location to map; keep it empty
+				branchMapping = &MappingResult{Source: locMapping.Source}
+			} else {
+				branchMapping, reason, err = ft.mapLocation(branchLoc)
+			}
+			if err == nil && branchMapping.Source != locMapping.Source {
+				reason, err = DropCrossSource, errCrossSource
+				crossSource = true
+			}
 			if err != nil {
+				if ft.strict {
+					return ft.drop(report, "branch", branchID, reason, err)
+				}
+				partial = append(partial, reason)
 				continue // Skip unmappable branch locations
 			}
-			if branchMapping.Source == locMapping.Source {
-				mappedLocations = append(mappedLocations, branchMapping.Location)
+			if reason != "" {
+				partial = append(partial, reason)
+			}
+			mapped := branchMapping.Location
+			mapped.Skip = branchLoc.Skip
+			mappedLocations = append(mappedLocations, mapped)
+			if i < len(hits) {
+				mappedHits = append(mappedHits, hits[i])
+			} else {
+				mappedHits = append(mappedHits, 0)
 			}
 		}
 
 		if len(mappedLocations) == 0 {
-			continue // Skip if no locations could be mapped
+			// Skip if no locations could be mapped
+			reason := DropNoMapping
+			if crossSource {
+				reason = DropCrossSource
+			}
+			if err := ft.drop(report, "branch", branchID, reason, nil); err != nil {
+				return err
+			}
+			continue
 		}
 
 		// Get or create file coverage for the original source
-		targetFC := ct.getOrCreateFileCoverage(result, locMapping.Source)
+		target := ct.targetFor(ft, locMapping.Source)
+		if target == nil {
+			report.drop(DropFiltered)
+			continue // Skip filtered sources
+		}
 
-		// Add branch to target file
-		newBranchID := ct.getNextID(targetFC.BranchMap)
-		targetFC.BranchMap[newBranchID] = BranchMeta{
+		// Add branch to target file, merging identical branches
+		target.addBranch(BranchMeta{
 			Type:      branchMeta.Type,
 			Loc:       locMapping.Location,
 			Locations: mappedLocations,
+		}, mappedHits)
+		report.Mapped++
+		for _, reason := range partial {
+			report.partial(reason)
 		}
-		targetFC.B[newBranchID] = hits
 	}
 
 	return nil
@@ -206,66 +660,14 @@ func (ct *CoverageTransformer) getOrCreateFileCoverage(result map[string]*FileCo
 	return fc
 }
 
-// getNextID generates the next available ID for a map
-func (ct *CoverageTransformer) getNextID(m interface{}) string {
-	var maxID int
-
-	switch typedMap := m.(type) {
-	case map[string]Location:
-		for id := range typedMap {
-			if intID, err := strconv.Atoi(id); err == nil && intID > maxID {
-				maxID = intID
-			}
-		}
-	case map[string]FunctionMeta:
-		for id := range typedMap {
-			if intID, err := strconv.Atoi(id); err == nil && intID > maxID {
-				maxID = intID
-			}
-		}
-	case map[string]BranchMeta:
-		for id := range typedMap {
-			if intID, err := strconv.Atoi(id); err == nil && intID > maxID {
-				maxID = intID
-			}
-		}
-	}
-
-	return strconv.Itoa(maxID + 1)
-}
-
-// mergeCoverage merges two FileCoverage objects
-func (ct *CoverageTransformer) mergeCoverage(target, source *FileCoverage) {
-	// Merge statements
-	for id, loc := range source.StatementMap {
-		newID := ct.getNextID(target.StatementMap)
-		target.StatementMap[newID] = loc
-		if hits, exists := source.S[id]; exists {
-			target.S[newID] = hits
-		}
-	}
-
-	// Merge functions
-	for id, fn := range source.FnMap {
-		newID := ct.getNextID(target.FnMap)
-		target.FnMap[newID] = fn
-		if hits, exists := source.F[id]; exists {
-			target.F[newID] = hits
-		}
-	}
-
-	// Merge branches
-	for id, branch := range source.BranchMap {
-		newID := ct.getNextID(target.BranchMap)
-		target.BranchMap[newID] = branch
-		if hits, exists := source.B[id]; exists {
-			target.B[newID] = hits
-		}
-	}
-}
-
 // TransformCoverage is a convenience function to transform coverage data
 func TransformCoverage(coverageJSON []byte) ([]byte, error) {
+	return TransformCoverageContext(context.Background(), coverageJSON)
+}
+
+// TransformCoverageContext is like TransformCoverage but stops with a
+// *CanceledError when ctx is done
+func TransformCoverageContext(ctx context.Context, coverageJSON []byte) ([]byte, error) {
 	// Parse input
 	coverage, err := ParseCoverageMap(coverageJSON)
 	if err != nil {
@@ -274,7 +676,7 @@ func TransformCoverage(coverageJSON []byte) ([]byte, error) {
 
 	// Transform
 	transformer := NewCoverageTransformer()
-	transformed, err := transformer.Transform(coverage)
+	transformed, err := transformer.TransformContext(ctx, coverage)
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform coverage: %w", err)
 	}
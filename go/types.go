@@ -1,6 +1,21 @@
 package istanbul
 
-import "encoding/json"
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EndOfLine is the column of an end position reaching the end of its line,
+// used like the Infinity end column of istanbul-lib-source-maps when no
+// later mapping tells where a range stops. Like Infinity in istanbul's JSON
+// output, it is encoded as a null column.
+const EndOfLine = math.MaxInt32
 
 // Position represents a position in source code (line, column)
 type Position struct {
@@ -8,10 +23,55 @@ type Position struct {
 	Column int `json:"column"`
 }
 
+// MarshalJSON encodes the position, with a null column for EndOfLine
+func (p Position) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, 32)
+	b = append(b, `{"line":`...)
+	b = strconv.AppendInt(b, int64(p.Line), 10)
+	b = append(b, `,"column":`...)
+	if p.Column == EndOfLine {
+		b = append(b, "null"...)
+	} else {
+		b = strconv.AppendInt(b, int64(p.Column), 10)
+	}
+	return append(b, '}'), nil
+}
+
+// UnmarshalJSON decodes a position, reading a null column as EndOfLine. A
+// missing column is zero.
+func (p *Position) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Line   int             `json:"line"`
+		Column json.RawMessage `json:"column"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	p.Line, p.Column = raw.Line, 0
+	switch {
+	case string(raw.Column) == "null":
+		p.Column = EndOfLine
+	case len(raw.Column) > 0:
+		return json.Unmarshal(raw.Column, &p.Column)
+	}
+	return nil
+}
+
 // Location represents a range in source code
 type Location struct {
 	Start Position `json:"start"`
 	End   Position `json:"end"`
+	// Skip marks a statement or branch location excluded from coverage, as
+	// written by istanbul for code with an ignore hint
+	Skip bool `json:"skip,omitempty"`
+}
+
+// isEmpty reports whether the location is unset, like the implicit else of an
+// if without else, which istanbul-lib-instrument writes as
+// {"start":{},"end":{}}
+func (loc Location) isEmpty() bool {
+	return loc == Location{}
 }
 
 // FunctionMeta represents function metadata
@@ -19,6 +79,7 @@ type FunctionMeta struct {
 	Name string   `json:"name"`
 	Decl Location `json:"decl"`
 	Loc  Location `json:"loc"`
+	Skip bool     `json:"skip,omitempty"` // excluded from coverage
 }
 
 // BranchMeta represents branch metadata
@@ -28,15 +89,111 @@ type BranchMeta struct {
 	Locations []Location `json:"locations"`
 }
 
-// SourceMap represents a source map
+// SourceMap represents a source map. A nil entry of SourcesContent is a
+// source whose content is unknown, encoded as null.
 type SourceMap struct {
-	Version        int      `json:"version"`
-	Sources        []string `json:"sources"`
-	Names          []string `json:"names"`
-	Mappings       string   `json:"mappings"`
-	File           string   `json:"file,omitempty"`
-	SourceRoot     string   `json:"sourceRoot,omitempty"`
-	SourcesContent []string `json:"sourcesContent,omitempty"`
+	Version        int                `json:"version"`
+	Sources        []string           `json:"sources"`
+	Names          []string           `json:"names"`
+	Mappings       string             `json:"mappings"`
+	File           string             `json:"file,omitempty"`
+	SourceRoot     string             `json:"sourceRoot,omitempty"`
+	SourcesContent []*string          `json:"sourcesContent,omitempty"`
+	Sections       []SourceMapSection `json:"sections,omitempty"` // index map sections
+	IgnoreList     []int              `json:"ignoreList,omitempty"`
+
+	// Extensions holds vendor "x_" fields (e.g. x_google_ignoreList) verbatim
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+// sourceMapFields is used to (un)marshal the known SourceMap fields
+// without recursing into the custom JSON methods
+type sourceMapFields SourceMap
+
+// UnmarshalJSON decodes a source map, keeping any "x_" extension fields
+func (sm *SourceMap) UnmarshalJSON(data []byte) error {
+	var fields sourceMapFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for key, value := range raw {
+		if strings.HasPrefix(key, "x_") {
+			if fields.Extensions == nil {
+				fields.Extensions = make(map[string]json.RawMessage)
+			}
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, value); err != nil {
+				return err
+			}
+			fields.Extensions[key] = compact.Bytes()
+		}
+	}
+
+	*sm = SourceMap(fields)
+	return nil
+}
+
+// MarshalJSON encodes a source map, appending any "x_" extension fields.
+// Missing sources and names of a flat map are encoded as empty arrays, as
+// consumers such as Mozilla's source-map library expect them.
+func (sm SourceMap) MarshalJSON() ([]byte, error) {
+	fields := sourceMapFields(sm)
+	if !sm.IsIndexed() {
+		if fields.Sources == nil {
+			fields.Sources = []string{}
+		}
+		if fields.Names == nil {
+			fields.Names = []string{}
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil || len(sm.Extensions) == 0 {
+		return data, err
+	}
+
+	keys := make([]string, 0, len(sm.Extensions))
+	for key := range sm.Extensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Splice extension fields in before the closing brace
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for _, key := range keys {
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value := sm.Extensions[key]
+		if len(value) == 0 {
+			value = json.RawMessage("null")
+		}
+		buf.WriteByte(',')
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// SourceMapSection represents a section of an indexed source map.
+// Offset is zero-based for both line and column, as in the source map spec.
+type SourceMapSection struct {
+	Offset Position   `json:"offset"`
+	URL    string     `json:"url,omitempty"`
+	Map    *SourceMap `json:"map,omitempty"`
+}
+
+// IsIndexed reports whether the source map is an index map made of sections
+func (sm *SourceMap) IsIndexed() bool {
+	return len(sm.Sections) > 0
 }
 
 // FileCoverage represents coverage data for a single file
@@ -49,6 +206,100 @@ type FileCoverage struct {
 	F              map[string]int          `json:"f"` // function hits
 	B              map[string][]int        `json:"b"` // branch hits
 	InputSourceMap *SourceMap              `json:"inputSourceMap,omitempty"`
+	CoverageSchema string                  `json:"_coverageSchema,omitempty"` // istanbul coverage schema hash
+	Hash           string                  `json:"hash,omitempty"`            // identifies the instrumented file
+	ContentHash    string                  `json:"contentHash,omitempty"`     // hash of the source code, if known
+}
+
+// defaultCoverageSchema is the _coverageSchema written by current versions
+// of istanbul-lib-instrument
+const defaultCoverageSchema = "1a1c01bbd47fc00a2c39e90264f33305804495a9"
+
+// fileCoverageFields is used to marshal FileCoverage without recursing
+type fileCoverageFields FileCoverage
+
+// MarshalJSON encodes the coverage with IDs in numeric order, followed by
+// the hashes as istanbul writes them
+func (fc FileCoverage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		fileCoverageFields
+		StatementMap   idMap[Location]     `json:"statementMap"`
+		FnMap          idMap[FunctionMeta] `json:"fnMap"`
+		BranchMap      idMap[BranchMeta]   `json:"branchMap"`
+		S              idMap[int]          `json:"s"`
+		F              idMap[int]          `json:"f"`
+		B              idMap[[]int]        `json:"b"`
+		CoverageSchema string              `json:"_coverageSchema,omitempty"`
+		Hash           string              `json:"hash,omitempty"`
+		ContentHash    string              `json:"contentHash,omitempty"`
+	}{
+		fileCoverageFields: fileCoverageFields(fc),
+		StatementMap:       fc.StatementMap,
+		FnMap:              fc.FnMap,
+		BranchMap:          fc.BranchMap,
+		S:                  fc.S,
+		F:                  fc.F,
+		B:                  fc.B,
+		CoverageSchema:     fc.CoverageSchema,
+		Hash:               fc.Hash,
+		ContentHash:        fc.ContentHash,
+	})
+}
+
+// pathOr returns the path of the file, or key when the path is empty
+func (fc *FileCoverage) pathOr(key string) string {
+	if fc.Path == "" {
+		return key
+	}
+	return fc.Path
+}
+
+// computeHash returns a SHA-1 of the path and the statement, function and
+// branch maps. Like the hash istanbul-lib-instrument derives from the source
+// code, it identifies the instrumented structure rather than the hits.
+func (fc *FileCoverage) computeHash() string {
+	// Locations and metadata always encode
+	data, _ := json.Marshal(struct {
+		Path         string              `json:"path"`
+		StatementMap idMap[Location]     `json:"statementMap"`
+		FnMap        idMap[FunctionMeta] `json:"fnMap"`
+		BranchMap    idMap[BranchMeta]   `json:"branchMap"`
+	}{fc.Path, fc.StatementMap, fc.FnMap, fc.BranchMap})
+
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// clone returns a deep copy of the coverage maps. The input source map is
+// shared as it is never modified.
+func (fc *FileCoverage) clone() *FileCoverage {
+	c := *fc
+	c.StatementMap = make(map[string]Location, len(fc.StatementMap))
+	for id, loc := range fc.StatementMap {
+		c.StatementMap[id] = loc
+	}
+	c.FnMap = make(map[string]FunctionMeta, len(fc.FnMap))
+	for id, fn := range fc.FnMap {
+		c.FnMap[id] = fn
+	}
+	c.BranchMap = make(map[string]BranchMeta, len(fc.BranchMap))
+	for id, branch := range fc.BranchMap {
+		branch.Locations = append([]Location(nil), branch.Locations...)
+		c.BranchMap[id] = branch
+	}
+	c.S = make(map[string]int, len(fc.S))
+	for id, hits := range fc.S {
+		c.S[id] = hits
+	}
+	c.F = make(map[string]int, len(fc.F))
+	for id, hits := range fc.F {
+		c.F[id] = hits
+	}
+	c.B = make(map[string][]int, len(fc.B))
+	for id, hits := range fc.B {
+		c.B[id] = append([]int(nil), hits...)
+	}
+	return &c
 }
 
 // CoverageMap represents coverage data for multiple files
@@ -57,6 +308,7 @@ type CoverageMap map[string]*FileCoverage
 // MappingResult represents a mapping result from source map
 type MappingResult struct {
 	Source   string
+	Name     string // original identifier name, if the segment has one
 	Location Location
 }
 
@@ -64,7 +316,7 @@ type MappingResult struct {
 func ParseCoverageMap(data []byte) (CoverageMap, error) {
 	var coverage CoverageMap
 	if err := json.Unmarshal(data, &coverage); err != nil {
-		return nil, err
+		return nil, newJSONError(err)
 	}
 	return coverage, nil
 }
@@ -0,0 +1,239 @@
+package istanbul
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValidationErrors lists every problem found in coverage data
+type ValidationErrors []*ValidationError
+
+// Error implements error
+func (errs ValidationErrors) Error() string {
+	switch len(errs) {
+	case 0:
+		return "no coverage validation problems"
+	case 1:
+		return errs[0].Error()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d coverage validation problems:", len(errs))
+	for _, err := range errs {
+		b.WriteString("\n\t")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the individual problems
+func (errs ValidationErrors) Unwrap() []error {
+	result := make([]error, len(errs))
+	for i, err := range errs {
+		result[i] = err
+	}
+	return result
+}
+
+// Is reports whether target is ErrInvalidCoverage
+func (errs ValidationErrors) Is(target error) bool {
+	return target == ErrInvalidCoverage
+}
+
+// coverageValidator collects the problems of coverage data
+type coverageValidator struct {
+	errs ValidationErrors
+}
+
+// validateCoverage checks every file of coverage, in path order
+func validateCoverage(coverage CoverageMap) ValidationErrors {
+	v := &coverageValidator{}
+	for _, filePath := range sortedPaths(coverage) {
+		v.file(filePath, coverage[filePath])
+	}
+	return v.errs
+}
+
+// add records a problem at the JSON pointer made of the escaped file key
+// followed by the given reference tokens
+func (v *coverageValidator) add(file, field, id, msg string, tokens ...string) {
+	pointer := "/" + escapePointer(file)
+	for _, token := range tokens {
+		pointer += "/" + escapePointer(token)
+	}
+	v.errs = append(v.errs, &ValidationError{File: file, Field: field, ID: id, Msg: msg, Pointer: pointer})
+}
+
+// file checks the coverage of one file
+func (v *coverageValidator) file(file string, fc *FileCoverage) {
+	if fc == nil {
+		v.add(file, "", "", "null coverage data")
+		return
+	}
+	if fc.Path == "" {
+		v.add(file, "path", "", "missing", "path")
+	}
+
+	for _, field := range []struct {
+		name  string
+		isNil bool
+	}{
+		{"statementMap", fc.StatementMap == nil},
+		{"fnMap", fc.FnMap == nil},
+		{"branchMap", fc.BranchMap == nil},
+		{"s", fc.S == nil},
+		{"f", fc.F == nil},
+		{"b", fc.B == nil},
+	} {
+		if field.isNil {
+			v.add(file, field.name, "", "missing", field.name)
+		}
+	}
+
+	v.statements(file, fc)
+	v.functions(file, fc)
+	v.branches(file, fc)
+	if fc.InputSourceMap != nil {
+		v.sourceMap(file, fc.InputSourceMap, "inputSourceMap")
+	}
+}
+
+// statements checks the statement map against the statement hits
+func (v *coverageValidator) statements(file string, fc *FileCoverage) {
+	for _, id := range sortedIDs(fc.StatementMap) {
+		v.location(file, "statementMap", id, fc.StatementMap[id], "statementMap", id)
+		if _, exists := fc.S[id]; !exists && fc.S != nil {
+			v.add(file, "s", id, "missing hit count for statement", "s", id)
+		}
+	}
+	for _, id := range sortedIDs(fc.S) {
+		if _, exists := fc.StatementMap[id]; !exists && fc.StatementMap != nil {
+			v.add(file, "s", id, "hit count for unknown statement", "s", id)
+		}
+	}
+}
+
+// functions checks the function map against the function hits
+func (v *coverageValidator) functions(file string, fc *FileCoverage) {
+	for _, id := range sortedIDs(fc.FnMap) {
+		fn := fc.FnMap[id]
+		v.location(file, "fnMap", id, fn.Decl, "fnMap", id, "decl")
+		v.location(file, "fnMap", id, fn.Loc, "fnMap", id, "loc")
+		if _, exists := fc.F[id]; !exists && fc.F != nil {
+			v.add(file, "f", id, "missing hit count for function", "f", id)
+		}
+	}
+	for _, id := range sortedIDs(fc.F) {
+		if _, exists := fc.FnMap[id]; !exists && fc.FnMap != nil {
+			v.add(file, "f", id, "hit count for unknown function", "f", id)
+		}
+	}
+}
+
+// branches checks the branch map against the branch hits
+func (v *coverageValidator) branches(file string, fc *FileCoverage) {
+	for _, id := range sortedIDs(fc.BranchMap) {
+		branch := fc.BranchMap[id]
+		v.location(file, "branchMap", id, branch.Loc, "branchMap", id, "loc")
+		for i, loc := range branch.Locations {
+			if loc.isEmpty() {
+				continue // Implicit else
+			}
+			v.location(file, "branchMap", id, loc, "branchMap", id, "locations", strconv.Itoa(i))
+		}
+
+		hits, exists := fc.B[id]
+		switch {
+		case fc.B == nil:
+		case !exists:
+			v.add(file, "b", id, "missing hit counts for branch", "b", id)
+		case len(hits) != len(branch.Locations):
+			v.add(file, "b", id, fmt.Sprintf("%d hit counts for %d branch locations", len(hits), len(branch.Locations)), "b", id)
+		}
+	}
+	for _, id := range sortedIDs(fc.B) {
+		if _, exists := fc.BranchMap[id]; !exists && fc.BranchMap != nil {
+			v.add(file, "b", id, "hit counts for unknown branch", "b", id)
+		}
+	}
+}
+
+// location checks that a location has positive lines, non-negative columns
+// and does not end before it starts
+func (v *coverageValidator) location(file, field, id string, loc Location, tokens ...string) {
+	for _, p := range []struct {
+		name string
+		pos  Position
+	}{{"start", loc.Start}, {"end", loc.End}} {
+		if p.pos.Line < 1 {
+			v.add(file, field, id, fmt.Sprintf("line %d is not positive", p.pos.Line), append(tokens, p.name, "line")...)
+		}
+		if p.pos.Column < 0 {
+			v.add(file, field, id, fmt.Sprintf("column %d is negative", p.pos.Column), append(tokens, p.name, "column")...)
+		}
+	}
+	if comparePositions(loc.End, loc.Start) < 0 {
+		v.add(file, field, id, "location ends before it starts", tokens...)
+	}
+}
+
+// sourceMap checks that a source map, or each section of an index map, is
+// version 3 with decodable mappings referring to existing sources and names
+func (v *coverageValidator) sourceMap(file string, sm *SourceMap, tokens ...string) {
+	if sm.Version != 3 {
+		v.add(file, "inputSourceMap", "", fmt.Sprintf("unsupported version %d", sm.Version), append(tokens, "version")...)
+	}
+
+	if sm.IsIndexed() {
+		for i, section := range sm.Sections {
+			sectionTokens := append(tokens[:len(tokens):len(tokens)], "sections", strconv.Itoa(i))
+			switch {
+			case section.Map != nil:
+				v.sourceMap(file, section.Map, append(sectionTokens, "map")...)
+			case section.URL == "":
+				v.add(file, "inputSourceMap", "", "section without map", sectionTokens...)
+			}
+		}
+		return
+	}
+
+	mappingsTokens := append(tokens[:len(tokens):len(tokens)], "mappings")
+	mappings, err := decodeMappings(sm.Mappings)
+	if err != nil {
+		v.add(file, "inputSourceMap", "", err.Error(), mappingsTokens...)
+		return
+	}
+
+	// Report each kind of bad index once, at its first segment
+	var badSource, badName *mapping
+	sourceCount, nameCount := 0, 0
+	for i := range mappings {
+		m := &mappings[i]
+		if m.source >= len(sm.Sources) || m.source < -1 {
+			if badSource == nil {
+				badSource = m
+			}
+			sourceCount++
+		}
+		if m.name >= len(sm.Names) || m.name < -1 {
+			if badName == nil {
+				badName = m
+			}
+			nameCount++
+		}
+	}
+	if badSource != nil {
+		v.add(file, "inputSourceMap", "", fmt.Sprintf("%d segments refer to missing sources, the first at %d:%d to source %d of %d",
+			sourceCount, badSource.genLine, badSource.genColumn, badSource.source, len(sm.Sources)), mappingsTokens...)
+	}
+	if badName != nil {
+		v.add(file, "inputSourceMap", "", fmt.Sprintf("%d segments refer to missing names, the first at %d:%d to name %d of %d",
+			nameCount, badName.genLine, badName.genColumn, badName.name, len(sm.Names)), mappingsTokens...)
+	}
+}
+
+// escapePointer escapes a JSON pointer reference token as in RFC 6901
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
@@ -0,0 +1,151 @@
+package istanbul
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validationProblems returns the pointer and message of every problem
+func validationProblems(t *testing.T, data string) map[string]string {
+	t.Helper()
+
+	err := ValidateCoverageData([]byte(data))
+	if err == nil {
+		return nil
+	}
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	assert.ErrorIs(t, err, ErrInvalidCoverage)
+
+	problems := make(map[string]string, len(errs))
+	for _, e := range errs {
+		problems[e.Pointer] = e.Msg
+	}
+	return problems
+}
+
+func TestValidateCoverageDataAcceptsTransformOutput(t *testing.T) {
+	transformed, err := NewCoverageTransformer().Transform(largeBundleCoverage(20))
+	require.NoError(t, err)
+	data, err := json.Marshal(transformed)
+	require.NoError(t, err)
+	assert.NoError(t, ValidateCoverageData(data))
+
+	// Including the input with its source map
+	data, err = json.Marshal(largeBundleCoverage(20))
+	require.NoError(t, err)
+	assert.NoError(t, ValidateCoverageData(data))
+}
+
+func TestValidateCoverageDataReportsAllProblems(t *testing.T) {
+	problems := validationProblems(t, `{
+		"src/a.js": {
+			"path": "src/a.js",
+			"statementMap": {
+				"0": {"start": {"line": 0, "column": 0}, "end": {"line": 1, "column": 5}},
+				"1": {"start": {"line": 2, "column": 4}, "end": {"line": 2, "column": -1}},
+				"2": {"start": {"line": 3, "column": 0}, "end": {"line": 3, "column": 5}}
+			},
+			"s": {"0": 1, "1": 0, "7": 3},
+			"fnMap": {
+				"0": {"name": "f", "decl": {"start": {"line": 5, "column": 0}, "end": {"line": 4, "column": 0}},
+				      "loc": {"start": {"line": 5, "column": 0}, "end": {"line": 6, "column": 1}}}
+			},
+			"f": {},
+			"branchMap": {
+				"0": {"type": "if", "loc": {"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 9}},
+				      "locations": [{"start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 9}}]}
+			},
+			"b": {"0": [1, 0], "1": [2]}
+		},
+		"src/b.js": {"path": "src/b.js", "statementMap": {}, "fnMap": {}, "branchMap": {}},
+		"dist/c.js": {
+			"path": "dist/c.js",
+			"statementMap": {}, "fnMap": {}, "branchMap": {}, "s": {}, "f": {}, "b": {},
+			"inputSourceMap": {"version": 2, "sources": ["a.ts"], "names": [], "mappings": "AAAA;ACAA,ACAA"}
+		},
+		"dist/d.js": {
+			"path": "dist/d.js",
+			"statementMap": {}, "fnMap": {}, "branchMap": {}, "s": {}, "f": {}, "b": {},
+			"inputSourceMap": {"version": 3, "sections": [
+				{"offset": {"line": 0, "column": 0}, "map": {"version": 3, "sources": [], "names": [], "mappings": "A!"}},
+				{"offset": {"line": 9, "column": 0}}
+			]}
+		}
+	}`)
+
+	assert.Equal(t, map[string]string{
+		"/src~1a.js/statementMap/0/start/line": "line 0 is not positive",
+		"/src~1a.js/statementMap/1/end/column": "column -1 is negative",
+		"/src~1a.js/statementMap/1":            "location ends before it starts",
+		"/src~1a.js/s/2":                       "missing hit count for statement",
+		"/src~1a.js/s/7":                       "hit count for unknown statement",
+		"/src~1a.js/fnMap/0/decl":              "location ends before it starts",
+		"/src~1a.js/f/0":                       "missing hit count for function",
+		"/src~1a.js/b/0":                       "2 hit counts for 1 branch locations",
+		"/src~1a.js/b/1":                       "hit counts for unknown branch",
+
+		"/src~1b.js/s": "missing",
+		"/src~1b.js/f": "missing",
+		"/src~1b.js/b": "missing",
+
+		"/dist~1c.js/inputSourceMap/version":  "unsupported version 2",
+		"/dist~1c.js/inputSourceMap/mappings": "2 segments refer to missing sources, the first at 2:0 to source 1 of 1",
+
+		"/dist~1d.js/inputSourceMap/sections/0/map/mappings": `invalid mappings: unexpected character '!' at offset 1`,
+		"/dist~1d.js/inputSourceMap/sections/1":              "section without map",
+	}, problems)
+}
+
+func TestValidateCoverageDataAcceptsImplicitElse(t *testing.T) {
+	ifWithoutElse := `{
+		"a.js": {
+			"path": "a.js",
+			"statementMap": {}, "fnMap": {}, "s": {}, "f": {},
+			"branchMap": {"0": {"type": "if", "loc": {"start": {"line": 1, "column": 0}, "end": {"line": 3, "column": 1}},
+				"locations": [{"start": {"line": 1, "column": 0}, "end": {"line": 3, "column": 1}}, %s]}},
+			"b": {"0": [1, 0]}
+		}
+	}`
+	assert.Nil(t, validationProblems(t, fmt.Sprintf(ifWithoutElse, `{"start": {}, "end": {}}`)))
+
+	// Partial or negative positions are still rejected
+	assert.Equal(t, map[string]string{
+		"/a.js/branchMap/0/locations/1/start/line": "line 0 is not positive",
+	}, validationProblems(t, fmt.Sprintf(ifWithoutElse, `{"start": {}, "end": {"line": 2, "column": 0}}`)))
+	assert.Equal(t, map[string]string{
+		"/a.js/branchMap/0/locations/1/start/column": "column -1 is negative",
+	}, validationProblems(t, fmt.Sprintf(ifWithoutElse,
+		`{"start": {"line": 1, "column": -1}, "end": {"line": 1, "column": 2}}`)))
+}
+
+func TestValidateCoverageDataNames(t *testing.T) {
+	problems := validationProblems(t, `{
+		"a.js": {
+			"path": "a.js",
+			"statementMap": {}, "fnMap": {}, "branchMap": {}, "s": {}, "f": {}, "b": {},
+			"inputSourceMap": {"version": 3, "sources": ["a.ts"], "names": ["x"], "mappings": "AAAAA,EAAAC"}
+		}
+	}`)
+	assert.Equal(t, map[string]string{
+		"/a.js/inputSourceMap/mappings": "1 segments refer to missing names, the first at 1:2 to name 1 of 1",
+	}, problems)
+}
+
+func TestValidationErrorsOrderAndMessage(t *testing.T) {
+	err := ValidateCoverageData([]byte(
+		`{"b.js": null, "a.js": {"statementMap": {}, "fnMap": {}, "branchMap": {}, "s": {}, "f": {}, "b": {}}}`,
+	))
+	var errs ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "/a.js/path", errs[0].Pointer)
+	assert.Equal(t, "/b.js", errs[1].Pointer)
+	assert.Equal(t, "2 coverage validation problems:\n"+
+		"\tinvalid coverage at /a.js/path: missing\n"+
+		"\tinvalid coverage at /b.js: null coverage data", err.Error())
+}